@@ -0,0 +1,153 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/types"
+)
+
+const (
+	// MaxLookupIDs is the maximum number of IDs or usernames the API accepts
+	// in a single lookup request.
+	MaxLookupIDs = 100
+
+	// DefaultBatchConcurrency is the number of batches looked up concurrently
+	// by a bulk lookup, if not otherwise specified.
+	DefaultBatchConcurrency = 4
+)
+
+// Batches splits keys into consecutive batches of at most size keys, and calls
+// lookup for each batch, with up to n calls active concurrently. It returns
+// the results of the calls in the order of their batches. If size <= 0, it
+// uses MaxLookupIDs; if n <= 0, it uses DefaultBatchConcurrency.
+//
+// If any call of lookup reports an error, the context passed to the remaining
+// calls is cancelled, no further batches are started, and Batches reports the
+// first error that occurred.
+//
+// Each call of lookup is typically a separate API request, and is subject to
+// the rate limiter and other policies of the client that sends it. A call
+// made with WithRequireAll on the context passed to lookup does not check its
+// reply, so that an object missing from one batch does not discard the
+// results of the others; the caller should check the merged reply instead
+// (see RequiresAll and CheckMissing).
+func Batches[R any](ctx context.Context, keys []string, size, n int, lookup func(context.Context, []string) (R, error)) ([]R, error) {
+	if size <= 0 {
+		size = MaxLookupIDs
+	}
+	if n <= 0 {
+		n = DefaultBatchConcurrency
+	}
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, batchKey{}, true))
+	defer cancel()
+
+	var μ sync.Mutex
+	var failed error
+	fail := func(err error) {
+		μ.Lock()
+		defer μ.Unlock()
+		if failed == nil {
+			failed = err
+			cancel()
+		}
+	}
+
+	out := make([]R, (len(keys)+size-1)/size)
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i := range out {
+		select {
+		case <-ctx.Done():
+			fail(ctx.Err())
+		case sem <- struct{}{}:
+			batch := keys[i*size : min((i+1)*size, len(keys))]
+			wg.Add(1)
+			go func(i int) {
+				defer func() { <-sem; wg.Done() }()
+				r, err := lookup(ctx, batch)
+				if err != nil {
+					fail(err)
+				}
+				out[i] = r
+			}(i)
+		}
+		if err := ctx.Err(); err != nil {
+			fail(err)
+			break
+		}
+	}
+	wg.Wait()
+	if failed != nil {
+		return nil, failed
+	}
+	return out, nil
+}
+
+// batchKey is the context key that marks a call made by Batches.
+type batchKey struct{}
+
+// inBatch reports whether ctx is the context of a call made by Batches.
+func inBatch(ctx context.Context) bool {
+	v, _ := ctx.Value(batchKey{}).(bool)
+	return v
+}
+
+// MergeReplies combines the replies from a batch of requests into a single
+// reply. The data of the combined reply is a JSON array of the data objects
+// of the inputs in order, and its includes are merged without duplicates as
+// by an Includes. The errors are concatenated in order, and the rate limit is
+// that of the last reply that reports one. The combined reply has no
+// metadata. Nil replies are ignored.
+func MergeReplies(rs []*Reply) (*Reply, error) {
+	var data []json.RawMessage
+	var incs Includes
+	var errs []*types.ErrorDetail
+	var limit *RateLimit
+	for _, r := range rs {
+		if r == nil {
+			continue
+		}
+		vs, err := splitArray(r.Data)
+		if err != nil {
+			return nil, &jape.Error{Data: r.Data, Message: "decoding reply data", Err: err}
+		}
+		data = append(data, vs...)
+		if err := incs.Add(r); err != nil {
+			return nil, err
+		}
+		errs = append(errs, r.Errors...)
+		if r.RateLimit != nil {
+			limit = r.RateLimit
+		}
+	}
+	out := incs.Reply()
+	if len(data) != 0 {
+		out.Data, _ = json.Marshal(data)
+	}
+	out.Errors = errs
+	out.RateLimit = limit
+	return out, nil
+}
+
+// splitArray decodes data as a JSON array of values. As a special case, a
+// JSON object is treated as an array of one value, and empty data as an
+// empty array.
+func splitArray(data json.RawMessage) ([]json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	} else if data[0] == '{' {
+		return []json.RawMessage{data}, nil
+	}
+	var vs []json.RawMessage
+	if err := json.Unmarshal(data, &vs); err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
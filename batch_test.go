@@ -0,0 +1,157 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+	"github.com/creachadair/twitter/users"
+)
+
+func TestBulkLookup(t *testing.T) {
+	var μ sync.Mutex
+	var active, maxActive, calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		μ.Lock()
+		active++
+		calls++
+		maxActive = max(maxActive, active)
+		μ.Unlock()
+		defer func() { μ.Lock(); active--; μ.Unlock() }()
+
+		keys := strings.Split(req.URL.Query().Get("ids"), ",")
+		if req.URL.Path == "/2/users/by" {
+			keys = strings.Split(req.URL.Query().Get("usernames"), ",")
+		}
+		if len(keys) > twitter.MaxLookupIDs || keys[0] == "bad" {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		// Report the objects in reverse order, and every multiple of 7 as an
+		// error. Include the same user with every batch, which should be
+		// merged.
+		var data []map[string]string
+		var errs []map[string]string
+		for i := len(keys) - 1; i >= 0; i-- {
+			if n, _ := strconv.Atoi(keys[i]); n%7 == 0 {
+				errs = append(errs, map[string]string{"value": keys[i], "title": "Not Found Error"})
+			} else if req.URL.Path == "/2/users/by" {
+				data = append(data, map[string]string{"id": keys[i], "username": strings.ToUpper(keys[i])})
+			} else {
+				data = append(data, map[string]string{"id": keys[i]})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"data":     data,
+			"errors":   errs,
+			"includes": map[string]any{"users": []map[string]string{{"id": "1"}}},
+		})
+	}))
+	defer srv.Close()
+
+	cli := twitter.NewClient(&jape.Client{HTTPClient: srv.Client(), BaseURL: srv.URL})
+	ctx := context.Background()
+
+	var ids []string
+	for i := 1; i <= 250; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+
+	q := tweets.LookupAll(ids, nil)
+	q.Concurrency = 2
+	rsp, err := q.Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("LookupAll failed: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("LookupAll: got %d calls, want 3", calls)
+	}
+	if maxActive > 2 {
+		t.Errorf("LookupAll: %d concurrent calls, want at most 2", maxActive)
+	}
+
+	var want []string
+	for _, id := range ids {
+		if n, _ := strconv.Atoi(id); n%7 != 0 {
+			want = append(want, id)
+		}
+	}
+	var got []string
+	for _, tw := range rsp.Tweets {
+		got = append(got, tw.ID)
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("LookupAll tweets:\n got %v\nwant %v", got, want)
+	}
+	if n := len(rsp.Errors); n != len(ids)-len(want) {
+		t.Errorf("LookupAll: got %d errors, want %d", n, len(ids)-len(want))
+	}
+	var data types.Tweets
+	if err := json.Unmarshal(rsp.Data, &data); err != nil || len(data) != len(want) {
+		t.Errorf("LookupAll data: got %d tweets, err=%v; want %d", len(data), err, len(want))
+	}
+	if us, err := rsp.IncludedUsers(); err != nil || len(us) != 1 {
+		t.Errorf("LookupAll includes: got %d users, err=%v; want 1", len(us), err)
+	}
+
+	urs, err := users.LookupAllByName([]string{"3", "1", "2", "14"}, nil).Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("LookupAllByName failed: %v", err)
+	}
+	got = nil
+	for _, u := range urs.Users {
+		got = append(got, u.Username)
+	}
+	if s := strings.Join(got, " "); s != "3 1 2" {
+		t.Errorf("LookupAllByName users: got %q, want %q", s, "3 1 2")
+	}
+
+	// With WithRequireAll, the missing IDs of every batch are reported
+	// together, along with the merged reply.
+	calls = 0
+	_, err = tweets.LookupAll(ids, nil).Invoke(ctx, cli, twitter.WithRequireAll())
+	var me *twitter.MissingError
+	if !errors.As(err, &me) {
+		t.Fatalf("LookupAll with WithRequireAll: got %v, want *MissingError", err)
+	}
+	if calls != 3 {
+		t.Errorf("LookupAll with WithRequireAll: got %d calls, want 3", calls)
+	}
+	var missing []string
+	for _, id := range ids {
+		if n, _ := strconv.Atoi(id); n%7 == 0 {
+			missing = append(missing, id)
+		}
+	}
+	if strings.Join(me.Missing, " ") != strings.Join(missing, " ") {
+		t.Errorf("Missing:\n got %v\nwant %v", me.Missing, missing)
+	}
+	if len(me.Errors) != len(missing) {
+		t.Errorf("Missing errors: got %d, want %d", len(me.Errors), len(missing))
+	}
+	data = nil
+	if err := json.Unmarshal(me.Reply.Data, &data); err != nil || len(data) != len(want) {
+		t.Errorf("Missing reply: got %d tweets, err=%v; want %d", len(data), err, len(want))
+	}
+	if _, err := users.LookupAllByName([]string{"3", "1"}, nil).Invoke(ctx, cli, twitter.WithRequireAll()); err != nil {
+		t.Errorf("LookupAllByName with WithRequireAll: unexpected error: %v", err)
+	}
+
+	// A failed batch fails the whole lookup.
+	if _, err := tweets.LookupAll(append(ids[:200:200], "bad"), nil).Invoke(ctx, cli); err == nil {
+		t.Error("LookupAll with a failing batch: got nil error")
+	}
+}
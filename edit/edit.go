@@ -19,6 +19,7 @@ func DeleteTweet(tweetID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:     "2/tweets/" + tweetID,
+			Template:   "2/tweets/:id",
 			HTTPMethod: "DELETE",
 		},
 		tag: "deleted",
@@ -34,11 +35,11 @@ type Query struct {
 
 // Invoke executes the query on the given context and client. A successful
 // response reports whether the edit took effect.
-func (e Query) Invoke(ctx context.Context, cli *twitter.Client) (bool, error) {
+func (e Query) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (bool, error) {
 	if e.encodeErr != nil {
 		return false, e.encodeErr // deferred encoding error
 	}
-	rsp, err := cli.Call(ctx, e.Request)
+	rsp, err := cli.Call(ctx, e.Request, opts...)
 	if err != nil {
 		return false, err
 	}
@@ -63,6 +64,7 @@ func SetRepliesHidden(tweetID string, hidden bool) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:      "2/tweets/" + tweetID + "/hidden",
+			Template:    "2/tweets/:id/hidden",
 			HTTPMethod:  "PUT",
 			ContentType: "application/json",
 			Data:        body,
@@ -82,6 +84,7 @@ func Like(userID, tweetID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:      "2/users/" + userID + "/likes",
+			Template:    "2/users/:id/likes",
 			HTTPMethod:  "POST",
 			ContentType: "application/json",
 			Data:        body,
@@ -98,6 +101,7 @@ func Unlike(userID, tweetID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:     "2/users/" + userID + "/likes/" + tweetID,
+			Template:   "2/users/:id/likes/:id",
 			HTTPMethod: "DELETE",
 		},
 		tag: "liked",
@@ -115,6 +119,7 @@ func Bookmark(userID, tweetID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:      "2/users/" + userID + "/bookmarks",
+			Template:    "2/users/:id/bookmarks",
 			HTTPMethod:  "POST",
 			ContentType: "application/json",
 			Data:        body,
@@ -132,6 +137,7 @@ func Unbookmark(userID, tweetID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:     "2/users/" + userID + "/bookmarks/" + tweetID,
+			Template:   "2/users/:id/bookmarks/:id",
 			HTTPMethod: "DELETE",
 		},
 		tag: "bookmarked",
@@ -148,6 +154,7 @@ func Retweet(userID, tweetID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:      "2/users/" + userID + "/retweets",
+			Template:    "2/users/:id/retweets",
 			HTTPMethod:  "POST",
 			ContentType: "application/json",
 			Data:        body,
@@ -165,6 +172,7 @@ func Unretweet(userID, tweetID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:     "2/users/" + userID + "/retweets/" + tweetID,
+			Template:   "2/users/:id/retweets/:id",
 			HTTPMethod: "DELETE",
 		},
 		tag: "retweeted",
@@ -181,6 +189,7 @@ func Block(userID, blockeeID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:      "2/users/" + userID + "/blocking",
+			Template:    "2/users/:id/blocking",
 			HTTPMethod:  "POST",
 			ContentType: "application/json",
 			Data:        body,
@@ -197,6 +206,7 @@ func Unblock(userID, blockeeID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:     "2/users/" + userID + "/blocking/" + blockeeID,
+			Template:   "2/users/:id/blocking/:id",
 			HTTPMethod: "DELETE",
 		},
 		tag: "blocking",
@@ -213,6 +223,7 @@ func Follow(userID, followeeID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:      "2/users/" + userID + "/following",
+			Template:    "2/users/:id/following",
 			HTTPMethod:  "POST",
 			ContentType: "application/json",
 			Data:        body,
@@ -232,6 +243,7 @@ func Unfollow(userID, followeeID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:     "2/users/" + userID + "/following/" + followeeID,
+			Template:   "2/users/:id/following/:id",
 			HTTPMethod: "DELETE",
 		},
 		tag: "following",
@@ -248,6 +260,7 @@ func Mute(userID, muteeID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:      "2/users/" + userID + "/muting",
+			Template:    "2/users/:id/muting",
 			HTTPMethod:  "POST",
 			ContentType: "application/json",
 			Data:        body,
@@ -264,6 +277,7 @@ func Unmute(userID, muteeID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:     "2/users/" + userID + "/muting/" + muteeID,
+			Template:   "2/users/:id/muting/:id",
 			HTTPMethod: "DELETE",
 		},
 		tag: "muting",
@@ -280,6 +294,7 @@ func PinList(userID, listID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:      "2/users/" + userID + "/pinned_lists",
+			Template:    "2/users/:id/pinned_lists",
 			HTTPMethod:  "POST",
 			ContentType: "application/json",
 			Data:        body,
@@ -296,6 +311,7 @@ func UnpinLists(userID, listID string) Query {
 	return Query{
 		Request: &jape.Request{
 			Method:     "2/users/" + userID + "/pinned_lists/" + listID,
+			Template:   "2/users/:id/pinned_lists/:id",
 			HTTPMethod: "DELETE",
 		},
 		tag: "pinned",
@@ -0,0 +1,125 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/creachadair/twitter/jape"
+)
+
+// Legacy (v1.1) API error codes used to classify errors.
+// See https://developer.twitter.com/en/support/twitter-api/error-troubleshooting
+const (
+	codeAuthFailed        = 32  // could not authenticate you
+	codePageNotFound      = 34  // sorry, that page does not exist
+	codeUserNotFound      = 50  // user not found
+	codeRateLimited       = 88  // rate limit exceeded
+	codeInvalidToken      = 89  // invalid or expired token
+	codeBadCredentials    = 99  // unable to verify your credentials
+	codeBadTimestamp      = 135 // timestamp out of bounds
+	codeStatusNotFound    = 144 // no status found with that ID
+	codeUpdateLimit       = 185 // user is over daily status update limit
+	codeDuplicateStatus   = 187 // status is a duplicate
+	codeBadAuthData       = 215 // bad authentication data
+	codeCredentialsDenied = 220 // credentials do not allow access
+)
+
+// problemTypePrefix is the common prefix of v2 API problem type URIs.
+const problemTypePrefix = "https://api.twitter.com/2/problems/"
+
+// apiError reports whether err is or wraps a *jape.Error, and if so returns it.
+func apiError(err error) (*jape.Error, bool) {
+	var e *jape.Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// problemType returns the suffix of the v2 problem type URI reported by e, or
+// "" if e does not report a v2 problem type.
+func problemType(e *jape.Error) string {
+	if e.Problem == nil {
+		return ""
+	}
+	return strings.TrimPrefix(e.Problem.Type, problemTypePrefix)
+}
+
+// hasCode reports whether e reports any of the given legacy error codes.
+func hasCode(e *jape.Error, codes ...int) bool {
+	for _, code := range codes {
+		if e.Problem.HasCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRateLimited reports whether err indicates that a request was refused
+// because a rate limit or usage cap was exceeded, either by the server or by
+// a RateLimiter.
+func IsRateLimited(err error) bool {
+	var rle *RateLimitError
+	if errors.As(err, &rle) {
+		return true
+	}
+	e, ok := apiError(err)
+	if !ok {
+		return false
+	}
+	return e.Status == http.StatusTooManyRequests || e.Status == 420 ||
+		problemType(e) == "usage-capped" ||
+		hasCode(e, codeRateLimited, codeUpdateLimit)
+}
+
+// IsNotFound reports whether err indicates that the requested resource does
+// not exist.
+func IsNotFound(err error) bool {
+	e, ok := apiError(err)
+	if !ok {
+		return false
+	}
+	return e.Status == http.StatusNotFound ||
+		problemType(e) == "resource-not-found" ||
+		hasCode(e, codePageNotFound, codeUserNotFound, codeStatusNotFound)
+}
+
+// IsAuthError reports whether err indicates that the request was not
+// authenticated, or that its credentials do not permit access to the
+// requested resource.
+func IsAuthError(err error) bool {
+	e, ok := apiError(err)
+	if !ok {
+		return false
+	}
+	switch problemType(e) {
+	case "not-authorized-for-resource", "client-forbidden", "unsupported-authentication":
+		return true
+	}
+	return e.Status == http.StatusUnauthorized ||
+		hasCode(e, codeAuthFailed, codeInvalidToken, codeBadCredentials,
+			codeBadTimestamp, codeBadAuthData, codeCredentialsDenied)
+}
+
+// IsTransient reports whether err indicates a failure that may succeed if the
+// request is retried later, such as a network error, a server error, or a
+// stalled stream. See also jape.IsTransient.
+func IsTransient(err error) bool {
+	return jape.IsTransient(err) || errors.Is(err, jape.ErrStreamStalled)
+}
+
+// IsDuplicateContent reports whether err indicates that the server refused to
+// create a tweet because its content duplicates an existing tweet.
+func IsDuplicateContent(err error) bool {
+	e, ok := apiError(err)
+	if !ok {
+		return false
+	} else if hasCode(e, codeDuplicateStatus) {
+		return true
+	}
+	return e.Problem != nil && e.Status == http.StatusForbidden &&
+		strings.Contains(strings.ToLower(e.Problem.Detail), "duplicate content")
+}
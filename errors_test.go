@@ -0,0 +1,71 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+)
+
+func TestErrorClasses(t *testing.T) {
+	const (
+		rateLimited = 1 << iota
+		notFound
+		authError
+		transient
+		duplicate
+	)
+	tests := []struct {
+		status int
+		body   string
+		want   int
+	}{
+		{429, `{"title":"Too Many Requests","detail":"Too Many Requests","type":"about:blank","status":429}`, rateLimited | transient},
+		{403, `{"errors":[{"code":88,"message":"Rate limit exceeded"}]}`, rateLimited},
+		{404, `{"errors":[{"code":34,"message":"Sorry, that page does not exist."}]}`, notFound},
+		{400, `{"title":"Not Found Error","type":"https://api.twitter.com/2/problems/resource-not-found"}`, notFound},
+		{401, `{"title":"Unauthorized","type":"about:blank","status":401,"detail":"Unauthorized"}`, authError},
+		{403, `{"errors":[{"code":220,"message":"Your credentials do not allow access to this resource."}]}`, authError},
+		{403, `{"title":"Forbidden","type":"about:blank","status":403,"detail":"You are not allowed to create a Tweet with duplicate content."}`, duplicate},
+		{403, `{"errors":[{"code":187,"message":"Status is a duplicate."}]}`, duplicate},
+		{503, `Service Unavailable`, transient},
+		{400, `{"title":"Invalid Request","detail":"One or more parameters to your request was invalid."}`, 0},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d", test.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			cli := twitter.NewClient(&jape.Client{HTTPClient: srv.Client(), BaseURL: srv.URL})
+			_, err := cli.Call(context.Background(), &jape.Request{Method: "2/tweets"})
+			if err == nil {
+				t.Fatal("Call: got nil error, want failure")
+			}
+			for _, c := range []struct {
+				name string
+				bit  int
+				f    func(error) bool
+			}{
+				{"IsRateLimited", rateLimited, twitter.IsRateLimited},
+				{"IsNotFound", notFound, twitter.IsNotFound},
+				{"IsAuthError", authError, twitter.IsAuthError},
+				{"IsTransient", transient, twitter.IsTransient},
+				{"IsDuplicateContent", duplicate, twitter.IsDuplicateContent},
+			} {
+				if got, want := c.f(err), test.want&c.bit != 0; got != want {
+					t.Errorf("%s(%v): got %v, want %v", c.name, err, got, want)
+				}
+			}
+		})
+	}
+}
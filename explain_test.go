@@ -0,0 +1,71 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/edit"
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/jape/auth"
+	"github.com/creachadair/twitter/lists"
+	"github.com/creachadair/twitter/tokens"
+	"github.com/creachadair/twitter/tweets"
+)
+
+func TestExplain(t *testing.T) {
+	ctx := context.Background()
+	cfg := auth.Config{APIKey: "api-key", APISecret: "api-secret"}
+	cli := twitter.NewClient(&jape.Client{
+		Authorize: cfg.Authorizer("user-token", "user-secret"),
+	})
+
+	check := func(t *testing.T, ex *jape.Explanation, err error, method, url string) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("Explain failed: %v", err)
+		}
+		t.Logf("Explanation:\n%s", ex.Describe())
+		if ex.Method != method || ex.URL != url {
+			t.Errorf("Explain: got %s %s, want %s %s", ex.Method, ex.URL, method, url)
+		}
+		if s := ex.Describe(); strings.Contains(s, "secret") || strings.Contains(s, "user-token") {
+			t.Errorf("Explanation contains a secret:\n%s", s)
+		}
+	}
+
+	t.Run("Block", func(t *testing.T) {
+		ex, err := twitter.Explain(ctx, cli, edit.Block("12", "13").Invoke)
+		check(t, ex, err, "POST", twitter.BaseURL+"/2/users/12/blocking")
+		if got, want := string(ex.Body), `{"target_user_id":"13"}`; got != want {
+			t.Errorf("Body: got %#q, want %#q", got, want)
+		}
+		if got := ex.Header.Get("Authorization"); !strings.HasPrefix(got, "OAuth ") {
+			t.Errorf("Authorization: got %q, want OAuth", got)
+		}
+	})
+
+	t.Run("DeleteList", func(t *testing.T) {
+		ex, err := twitter.Explain(ctx, cli, lists.Delete("99").Invoke)
+		check(t, ex, err, "DELETE", twitter.BaseURL+"/2/lists/99")
+	})
+
+	t.Run("Bearer", func(t *testing.T) {
+		ex, err := twitter.Explain(ctx, cli, tokens.GetBearer(cfg, nil).Invoke)
+		check(t, ex, err, "POST", twitter.BaseURL+"/oauth2/token?grant_type=client_credentials")
+		if got := ex.Header.Get("Authorization"); got != "Basic "+jape.Redacted {
+			t.Errorf("Authorization: got %q, want Basic %s", got, jape.Redacted)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		ex, err := twitter.ExplainFunc(ctx, cli, tweets.SampleStream(func(*tweets.Reply) error {
+			t.Error("Unexpected stream message")
+			return nil
+		}, nil).Invoke)
+		check(t, ex, err, "GET", twitter.BaseURL+"/2/tweets/sample/stream")
+	})
+}
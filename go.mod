@@ -1,7 +1,5 @@
 module github.com/creachadair/twitter
 
-go 1.20
+go 1.21
 
-require github.com/dnaeon/go-vcr/v2 v2.1.0
-
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,283 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"strings"
+
+	"github.com/creachadair/twitter/types"
+)
+
+// A TweetNode is a tweet whose expansions have been resolved to the objects
+// they refer to. Each field is populated only with the objects that could be
+// resolved; see Unresolved.
+type TweetNode struct {
+	*types.Tweet
+
+	Author           *UserNode        // expansion: author_id
+	InReplyToUser    *UserNode        // expansion: in_reply_to_user_id
+	MentionedUsers   []*UserNode      // expansion: entities.mentions.username
+	ReferencedTweets []*ReferenceNode // expansion: referenced_tweets.id
+	Media            []*types.Media   // expansion: attachments.media_keys
+	Polls            []*types.Poll    // expansion: attachments.poll_ids
+	Place            *types.Place     // expansion: geo.place_id
+}
+
+// A ReferenceNode is a resolved reference from one tweet to another.
+type ReferenceNode struct {
+	Type  string // e.g., "quoted", "replied_to", "retweeted"
+	Tweet *TweetNode
+}
+
+// A UserNode is a user whose expansions have been resolved.
+type UserNode struct {
+	*types.User
+
+	PinnedTweet *TweetNode // expansion: pinned_tweet_id
+}
+
+// A ListNode is a list whose expansions have been resolved.
+type ListNode struct {
+	*types.List
+
+	Owner *UserNode // expansion: owner_id
+}
+
+// An Unresolved records a reference from one object to another that could not
+// be resolved from the includes of a reply. This may mean the corresponding
+// expansion was not requested, or that the server did not report the object,
+// for example because it was deleted or is not visible to the caller. In the
+// latter case, the Errors of the reply may give the reason.
+type Unresolved struct {
+	Type  string // the type of the referring object: "tweet", "user", or "list"
+	ID    string // the ID of the referring object
+	Field string // the expansion field, e.g., "author_id"
+	Ref   string // the ID, media key, or username that was not resolved
+}
+
+// Hydrated is the result of resolving the expansions of the objects in a
+// reply.
+type Hydrated[T any] struct {
+	Items      []T           // the resolved objects, in their original order
+	Unresolved []*Unresolved // references that could not be resolved
+}
+
+// HydrateTweets resolves the expansions of ts using the includes of r, which
+// is typically the reply from which ts were decoded. Referenced tweets and the
+// pinned tweets of users are resolved recursively. Each object is resolved
+// only once, so the same node may be reachable by multiple paths, and the
+// graph of nodes may contain cycles.
+func HydrateTweets(r *Reply, ts []*types.Tweet) (*Hydrated[*TweetNode], error) {
+	g, err := newGraph(r)
+	if err != nil {
+		return nil, err
+	}
+	g.addTweets(ts)
+	out := &Hydrated[*TweetNode]{Items: make([]*TweetNode, len(ts))}
+	for i, t := range ts {
+		out.Items[i] = g.tweetNode(t)
+	}
+	out.Unresolved = g.unresolved
+	return out, nil
+}
+
+// HydrateUsers resolves the expansions of us using the includes of r, as
+// HydrateTweets does for tweets.
+func HydrateUsers(r *Reply, us []*types.User) (*Hydrated[*UserNode], error) {
+	g, err := newGraph(r)
+	if err != nil {
+		return nil, err
+	}
+	g.addUsers(us)
+	out := &Hydrated[*UserNode]{Items: make([]*UserNode, len(us))}
+	for i, u := range us {
+		out.Items[i] = g.userNode(u)
+	}
+	out.Unresolved = g.unresolved
+	return out, nil
+}
+
+// HydrateLists resolves the expansions of ls using the includes of r, as
+// HydrateTweets does for tweets.
+func HydrateLists(r *Reply, ls []*types.List) (*Hydrated[*ListNode], error) {
+	g, err := newGraph(r)
+	if err != nil {
+		return nil, err
+	}
+	out := &Hydrated[*ListNode]{Items: make([]*ListNode, len(ls))}
+	for i, l := range ls {
+		node := &ListNode{List: l}
+		if l.OwnerID != "" {
+			node.Owner = g.userByID("list", l.ID, "owner_id", l.OwnerID)
+		}
+		out.Items[i] = node
+	}
+	out.Unresolved = g.unresolved
+	return out, nil
+}
+
+// A graph indexes the objects of a reply, and the nodes resolved from them.
+type graph struct {
+	tweets map[string]*types.Tweet
+	users  map[string]*types.User
+	names  map[string]*types.User // by lower-case username
+	media  map[string]*types.Media
+	polls  map[string]*types.Poll
+	places map[string]*types.Place
+
+	tweetNodes map[string]*TweetNode
+	userNodes  map[string]*UserNode
+	unresolved []*Unresolved
+}
+
+func newGraph(r *Reply) (*graph, error) {
+	g := &graph{
+		tweets:     make(map[string]*types.Tweet),
+		users:      make(map[string]*types.User),
+		names:      make(map[string]*types.User),
+		media:      make(map[string]*types.Media),
+		polls:      make(map[string]*types.Poll),
+		places:     make(map[string]*types.Place),
+		tweetNodes: make(map[string]*TweetNode),
+		userNodes:  make(map[string]*UserNode),
+	}
+	if r == nil {
+		return g, nil
+	}
+	tweets, err := r.IncludedTweets()
+	if err != nil {
+		return nil, err
+	}
+	users, err := r.IncludedUsers()
+	if err != nil {
+		return nil, err
+	}
+	media, err := r.IncludedMedia()
+	if err != nil {
+		return nil, err
+	}
+	polls, err := r.IncludedPolls()
+	if err != nil {
+		return nil, err
+	}
+	places, err := r.IncludedPlaces()
+	if err != nil {
+		return nil, err
+	}
+	g.addTweets(tweets)
+	g.addUsers(users)
+	for _, m := range media {
+		g.media[m.Key] = m
+	}
+	for _, p := range polls {
+		g.polls[p.ID] = p
+	}
+	for _, p := range places {
+		g.places[p.ID] = p
+	}
+	return g, nil
+}
+
+// addTweets adds ts to the index, replacing included tweets with the same ID.
+func (g *graph) addTweets(ts []*types.Tweet) {
+	for _, t := range ts {
+		g.tweets[t.ID] = t
+	}
+}
+
+// addUsers adds us to the index, replacing included users with the same ID.
+func (g *graph) addUsers(us []*types.User) {
+	for _, u := range us {
+		g.users[u.ID] = u
+		g.names[strings.ToLower(u.Username)] = u
+	}
+}
+
+func (g *graph) missing(typ, id, field, ref string) {
+	g.unresolved = append(g.unresolved, &Unresolved{Type: typ, ID: id, Field: field, Ref: ref})
+}
+
+// tweetNode returns the node for t, resolving it if necessary.
+func (g *graph) tweetNode(t *types.Tweet) *TweetNode {
+	if node, ok := g.tweetNodes[t.ID]; ok {
+		return node
+	}
+	node := &TweetNode{Tweet: t}
+	g.tweetNodes[t.ID] = node // before resolving, in case of cycles
+
+	if t.AuthorID != "" {
+		node.Author = g.userByID("tweet", t.ID, "author_id", t.AuthorID)
+	}
+	if t.InReplyTo != "" {
+		node.InReplyToUser = g.userByID("tweet", t.ID, "in_reply_to_user_id", t.InReplyTo)
+	}
+	if t.Entities != nil {
+		for _, m := range t.Entities.Mentions {
+			if u, ok := g.names[strings.ToLower(m.Username)]; ok {
+				node.MentionedUsers = append(node.MentionedUsers, g.userNode(u))
+			} else {
+				g.missing("tweet", t.ID, "entities.mentions.username", m.Username)
+			}
+		}
+	}
+	for _, ref := range t.Referenced {
+		if rt, ok := g.tweets[ref.ID]; ok {
+			node.ReferencedTweets = append(node.ReferencedTweets, &ReferenceNode{
+				Type:  ref.Type,
+				Tweet: g.tweetNode(rt),
+			})
+		} else {
+			g.missing("tweet", t.ID, "referenced_tweets.id", ref.ID)
+		}
+	}
+	for _, key := range t.Attachments["media_keys"] {
+		if m, ok := g.media[key]; ok {
+			node.Media = append(node.Media, m)
+		} else {
+			g.missing("tweet", t.ID, "attachments.media_keys", key)
+		}
+	}
+	for _, id := range t.Attachments["poll_ids"] {
+		if p, ok := g.polls[id]; ok {
+			node.Polls = append(node.Polls, p)
+		} else {
+			g.missing("tweet", t.ID, "attachments.poll_ids", id)
+		}
+	}
+	if t.Location != nil && t.Location.PlaceID != "" {
+		if p, ok := g.places[t.Location.PlaceID]; ok {
+			node.Place = p
+		} else {
+			g.missing("tweet", t.ID, "geo.place_id", t.Location.PlaceID)
+		}
+	}
+	return node
+}
+
+// userNode returns the node for u, resolving it if necessary.
+func (g *graph) userNode(u *types.User) *UserNode {
+	if node, ok := g.userNodes[u.ID]; ok {
+		return node
+	}
+	node := &UserNode{User: u}
+	g.userNodes[u.ID] = node // before resolving, in case of cycles
+
+	if u.PinnedTweetID != "" {
+		if t, ok := g.tweets[u.PinnedTweetID]; ok {
+			node.PinnedTweet = g.tweetNode(t)
+		} else {
+			g.missing("user", u.ID, "pinned_tweet_id", u.PinnedTweetID)
+		}
+	}
+	return node
+}
+
+// userByID returns the node for the user with the given ID, or records that
+// the reference from the specified object could not be resolved.
+func (g *graph) userByID(typ, id, field, userID string) *UserNode {
+	if u, ok := g.users[userID]; ok {
+		return g.userNode(u)
+	}
+	g.missing(typ, id, field, userID)
+	return nil
+}
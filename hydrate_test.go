@@ -0,0 +1,99 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+)
+
+const hydrateInput = `{
+  "data": [{
+    "id": "1", "text": "@bee @nobody look", "author_id": "100", "in_reply_to_user_id": "200",
+    "entities": {"mentions": [{"username": "Bee"}, {"username": "nobody"}]},
+    "referenced_tweets": [{"type": "quoted", "id": "2"}, {"type": "replied_to", "id": "3"}],
+    "attachments": {"media_keys": ["m1", "m2"], "poll_ids": ["p1"]},
+    "geo": {"place_id": "x1"}
+  }],
+  "includes": {
+    "tweets": [{"id": "2", "text": "quoted", "author_id": "300"}],
+    "users": [
+      {"id": "100", "username": "ay"},
+      {"id": "200", "username": "bee"},
+      {"id": "300", "username": "cee", "pinned_tweet_id": "1"}
+    ],
+    "media": [{"media_key": "m1", "type": "photo"}],
+    "polls": [{"id": "p1", "options": []}],
+    "places": [{"id": "x1", "full_name": "Somewhere"}]
+  }
+}`
+
+func TestHydrate(t *testing.T) {
+	var rsp twitter.Reply
+	if err := json.Unmarshal([]byte(hydrateInput), &rsp); err != nil {
+		t.Fatalf("Decoding reply: %v", err)
+	}
+	var ts types.Tweets
+	if err := json.Unmarshal(rsp.Data, &ts); err != nil {
+		t.Fatalf("Decoding tweets: %v", err)
+	}
+	h, err := (&tweets.Reply{Reply: &rsp, Tweets: ts}).Hydrate()
+	if err != nil {
+		t.Fatalf("Hydrate failed: %v", err)
+	}
+	if len(h.Items) != 1 {
+		t.Fatalf("Hydrate: got %d tweets, want 1", len(h.Items))
+	}
+
+	tw := h.Items[0]
+	if tw.Author == nil || tw.Author.Username != "ay" {
+		t.Errorf("Author: got %+v, want ay", tw.Author)
+	}
+	if tw.InReplyToUser == nil || tw.InReplyToUser.Username != "bee" {
+		t.Errorf("InReplyToUser: got %+v, want bee", tw.InReplyToUser)
+	}
+	if len(tw.MentionedUsers) != 1 || tw.MentionedUsers[0] != tw.InReplyToUser {
+		t.Errorf("MentionedUsers: got %+v, want [bee]", tw.MentionedUsers)
+	}
+	if len(tw.Media) != 1 || tw.Media[0].Key != "m1" {
+		t.Errorf("Media: got %+v, want [m1]", tw.Media)
+	}
+	if len(tw.Polls) != 1 || tw.Polls[0].ID != "p1" {
+		t.Errorf("Polls: got %+v, want [p1]", tw.Polls)
+	}
+	if tw.Place == nil || tw.Place.FullName != "Somewhere" {
+		t.Errorf("Place: got %+v, want Somewhere", tw.Place)
+	}
+
+	// The quoted tweet is resolved with its author, whose pinned tweet is the
+	// original tweet.
+	if len(tw.ReferencedTweets) != 1 {
+		t.Fatalf("ReferencedTweets: got %d, want 1", len(tw.ReferencedTweets))
+	}
+	ref := tw.ReferencedTweets[0]
+	if ref.Type != "quoted" || ref.Tweet.ID != "2" {
+		t.Errorf("ReferencedTweets[0]: got %s %s, want quoted 2", ref.Type, ref.Tweet.ID)
+	}
+	if a := ref.Tweet.Author; a == nil || a.Username != "cee" {
+		t.Errorf("Quoted author: got %+v, want cee", a)
+	} else if a.PinnedTweet != tw {
+		t.Errorf("Pinned tweet: got %p, want %p", a.PinnedTweet, tw)
+	}
+
+	want := []*twitter.Unresolved{
+		{Type: "tweet", ID: "1", Field: "entities.mentions.username", Ref: "nobody"},
+		{Type: "tweet", ID: "1", Field: "referenced_tweets.id", Ref: "3"},
+		{Type: "tweet", ID: "1", Field: "attachments.media_keys", Ref: "m2"},
+	}
+	if !reflect.DeepEqual(h.Unresolved, want) {
+		for _, u := range h.Unresolved {
+			t.Logf("Unresolved: %+v", u)
+		}
+		t.Errorf("Unresolved: got %d references, want %d", len(h.Unresolved), len(want))
+	}
+}
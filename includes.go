@@ -0,0 +1,168 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/types"
+)
+
+// IncludeType is the set of object types that can be reported in the includes
+// of a reply.
+type IncludeType interface {
+	types.Tweet | types.User | types.Media | types.Poll | types.Place
+}
+
+// IncludeKind returns the name of the include kind for objects of type T,
+// for example "users" for types.User.
+func IncludeKind[T IncludeType]() string {
+	switch any((*T)(nil)).(type) {
+	case *types.Tweet:
+		return "tweets"
+	case *types.User:
+		return "users"
+	case *types.Media:
+		return "media"
+	case *types.Poll:
+		return "polls"
+	case *types.Place:
+		return "places"
+	}
+	panic("unreachable")
+}
+
+// Included decodes the objects of type T in the includes of r. It returns nil
+// without error if there are no such objects. Includes of other kinds,
+// including those not known to this package, remain available as raw JSON in
+// r.Includes.
+func Included[T IncludeType](r *Reply) ([]*T, error) {
+	kind := IncludeKind[T]()
+	data, ok := r.Includes[kind]
+	if !ok || len(data) == 0 {
+		return nil, nil
+	}
+	var out []*T
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, &jape.Error{Data: data, Message: "decoding " + kind, Err: err}
+	}
+	return out, nil
+}
+
+// Includes accumulates the includes of multiple replies, such as the pages
+// of a paginated query or the batches of a bulk lookup, discarding duplicate
+// objects. Objects are identified by their ID, or by their media key for
+// media; objects of a kind that has neither are identified by their content.
+// When the same object is included more than once, the last version added
+// replaces the earlier ones, in the position of the first.
+//
+// Includes of all kinds are accumulated, including kinds not known to this
+// package. A zero Includes is empty and ready for use.
+type Includes struct {
+	kinds map[string]*includeSet
+}
+
+type includeSet struct {
+	values []json.RawMessage
+	index  map[string]int // key → offset in values
+}
+
+// Add adds the includes of r to inc. If r == nil, Add does nothing.
+func (inc *Includes) Add(r *Reply) error {
+	if r == nil {
+		return nil
+	}
+	for kind, data := range r.Includes {
+		vs, err := splitArray(data)
+		if err != nil {
+			return &jape.Error{Data: data, Message: "decoding " + kind, Err: err}
+		}
+		if err := inc.addValues(kind, vs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (inc *Includes) addValues(kind string, vs []json.RawMessage) error {
+	if inc.kinds == nil {
+		inc.kinds = make(map[string]*includeSet)
+	}
+	set, ok := inc.kinds[kind]
+	if !ok {
+		set = &includeSet{index: make(map[string]int)}
+		inc.kinds[kind] = set
+	}
+	for _, v := range vs {
+		key, err := includeKey(v)
+		if err != nil {
+			return &jape.Error{Data: v, Message: "decoding " + kind, Err: err}
+		}
+		if i, ok := set.index[key]; ok {
+			set.values[i] = v
+		} else {
+			set.index[key] = len(set.values)
+			set.values = append(set.values, v)
+		}
+	}
+	return nil
+}
+
+// includeKey returns the key that identifies the included object v.
+func includeKey(v json.RawMessage) (string, error) {
+	var obj struct {
+		ID  string `json:"id"`
+		Key string `json:"media_key"`
+	}
+	if len(v) != 0 && v[0] == '{' {
+		if err := json.Unmarshal(v, &obj); err != nil {
+			return "", err
+		}
+	}
+	switch {
+	case obj.ID != "":
+		return "id:" + obj.ID, nil
+	case obj.Key != "":
+		return "key:" + obj.Key, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err != nil {
+		return "", err
+	}
+	return "value:" + buf.String(), nil
+}
+
+// Kinds returns the kinds of objects in inc, in lexicographic order.
+func (inc *Includes) Kinds() []string {
+	kinds := make([]string, 0, len(inc.kinds))
+	for kind := range inc.kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Len reports the number of distinct objects of the specified kind in inc.
+func (inc *Includes) Len(kind string) int {
+	if set, ok := inc.kinds[kind]; ok {
+		return len(set.values)
+	}
+	return 0
+}
+
+// Reply returns a reply whose includes are the contents of inc, and which has
+// no other data. The result can be passed to Included or to HydrateTweets and
+// its counterparts.
+func (inc *Includes) Reply() *Reply {
+	out := new(Reply)
+	if len(inc.kinds) != 0 {
+		out.Includes = make(map[string]json.RawMessage, len(inc.kinds))
+		for kind, set := range inc.kinds {
+			out.Includes[kind], _ = json.Marshal(set.values)
+		}
+	}
+	return out
+}
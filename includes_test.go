@@ -0,0 +1,74 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/types"
+)
+
+func TestIncludes(t *testing.T) {
+	pages := []string{
+		`{"includes": {
+		   "users": [{"id": "1", "username": "a"}, {"id": "2", "username": "b"}],
+		   "tweets": [{"id": "10", "text": "pinned"}],
+		   "topics": [{"name": "cats"}, {"name": "dogs"}]
+		}}`,
+		`{"includes": {
+		   "users": [{"id": "3", "username": "c"}, {"id": "1", "username": "a2"}],
+		   "media": [{"media_key": "m1", "type": "photo"}, {"media_key": "m1", "type": "video"}],
+		   "topics": [{"name":  "cats"}]
+		}}`,
+	}
+	var inc twitter.Includes
+	for i, page := range pages {
+		var rsp twitter.Reply
+		if err := json.Unmarshal([]byte(page), &rsp); err != nil {
+			t.Fatalf("Decoding page %d: %v", i+1, err)
+		}
+		if err := inc.Add(&rsp); err != nil {
+			t.Fatalf("Add page %d: %v", i+1, err)
+		}
+	}
+
+	if got, want := fmt.Sprint(inc.Kinds()), "[media topics tweets users]"; got != want {
+		t.Errorf("Kinds: got %s, want %s", got, want)
+	}
+	for kind, want := range map[string]int{"users": 3, "tweets": 1, "media": 1, "topics": 2, "polls": 0} {
+		if got := inc.Len(kind); got != want {
+			t.Errorf("Len(%q): got %d, want %d", kind, got, want)
+		}
+	}
+
+	rsp := inc.Reply()
+	users, err := twitter.Included[types.User](rsp)
+	if err != nil {
+		t.Fatalf("Included users: %v", err)
+	}
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	if got, want := fmt.Sprint(names), "[a2 b c]"; got != want {
+		t.Errorf("Included users: got %s, want %s", got, want)
+	}
+	if media, err := rsp.IncludedMedia(); err != nil || len(media) != 1 || media[0].Type != "video" {
+		t.Errorf("IncludedMedia: got %+v, %v; want one video", media, err)
+	}
+	if polls, err := twitter.Included[types.Poll](rsp); err != nil || polls != nil {
+		t.Errorf("Included polls: got %+v, %v; want nil, nil", polls, err)
+	}
+
+	// Unknown kinds are retained as raw JSON.
+	var topics []map[string]string
+	if err := json.Unmarshal(rsp.Includes["topics"], &topics); err != nil {
+		t.Fatalf("Decoding topics: %v", err)
+	}
+	if got, want := fmt.Sprint(topics), "[map[name:cats] map[name:dogs]]"; got != want {
+		t.Errorf("Topics: got %s, want %s", got, want)
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"github.com/creachadair/twitter/types"
 )
 
-const nextTokenParam = "cursor"
+// NextTokenParam is the name of the query parameter used to send a page
+// token to the v1.1 API.
+const NextTokenParam = "cursor"
 
 // A UsersReply is the response from a request that returns users.
 type UsersReply struct {
@@ -27,18 +29,18 @@ type UsersReply struct {
 // true for a freshly-constructed request, and for an invoked request where the
 // server not reported a next-page token.
 func HasMorePages(req *jape.Request) bool {
-	v, ok := req.Params[nextTokenParam]
+	v, ok := req.Params[NextTokenParam]
 	return !ok || (v[0] != "" && v[0] != "0")
 }
 
 // ResetPageToken resets (clears) the request's current page token.
 // Subsequently invoking the query will then fetch the first page of results.
-func ResetPageToken(req *jape.Request) { req.Params.Reset(nextTokenParam) }
+func ResetPageToken(req *jape.Request) { req.Params.Reset(NextTokenParam) }
 
 // GetUsers invokes an API method that returns API v1.1 user objects and
 // pagination metadata.
-func GetUsers(ctx context.Context, req *jape.Request, opts types.UserFields, cli *twitter.Client) (*UsersReply, error) {
-	data, err := cli.CallRaw(ctx, req)
+func GetUsers(ctx context.Context, req *jape.Request, opts types.UserFields, cli *twitter.Client, copts ...twitter.CallOption) (*UsersReply, error) {
+	data, err := cli.CallRaw(ctx, req, copts...)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +55,7 @@ func GetUsers(ctx context.Context, req *jape.Request, opts types.UserFields, cli
 	if nextPage == "0" {
 		nextPage = ""
 	}
-	req.Params.Set(nextTokenParam, nextPage)
+	req.Params.Set(NextTokenParam, nextPage)
 	out := &UsersReply{Data: data, NextToken: nextPage}
 	for _, u := range rsp.U {
 		out.Users = append(out.Users, u.ToUserV2(opts))
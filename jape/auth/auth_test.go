@@ -3,8 +3,11 @@
 package auth_test
 
 import (
+	"net/http"
+	"regexp"
 	"testing"
 
+	"github.com/creachadair/twitter/jape"
 	"github.com/creachadair/twitter/jape/auth"
 )
 
@@ -47,3 +50,50 @@ func TestKnownInputs(t *testing.T) {
 		t.Errorf("Authorization:\ngot:  %s\nwant: %s", ad.Authorization, wantAuth)
 	}
 }
+
+func TestMultipartExcluded(t *testing.T) {
+	cfg := auth.Config{
+		APIKey:            "key",
+		APISecret:         "secret",
+		AccessToken:       "token",
+		AccessTokenSecret: "token-secret",
+		MakeNonce:         func() string { return "nonce" },
+	}
+
+	var m jape.Multipart
+	m.AddField("status", "this should not be signed")
+	req := &jape.Request{
+		Method:     "1.1/media/upload.json",
+		HTTPMethod: "POST",
+		Params:     jape.Params{"media_category": {"tweet_image"}},
+		Multipart:  &m,
+	}
+	u, err := req.URL("https://upload.twitter.com")
+	if err != nil {
+		t.Fatalf("URL: %v", err)
+	}
+	body, _, ctype := req.Body()
+	hreq, err := http.NewRequest(req.HTTPMethod, u, body)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	defer hreq.Body.Close()
+	hreq.Header.Set("Content-Type", ctype)
+	if err := cfg.Authorize(hreq); err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	// The signature should cover only the query parameters.
+	got := hreq.Header.Get("Authorization")
+	ts := regexp.MustCompile(`oauth_timestamp="(\d+)"`).FindStringSubmatch(got)
+	if ts == nil {
+		t.Fatalf("Authorization has no timestamp: %q", got)
+	}
+	want := cfg.Sign("POST", "https://upload.twitter.com/1.1/media/upload.json", auth.Params{
+		"media_category":  "tweet_image",
+		"oauth_timestamp": ts[1],
+	}).Authorization
+	if got != want {
+		t.Errorf("Authorization:\ngot:  %s\nwant: %s", got, want)
+	}
+}
@@ -119,8 +119,9 @@ func (c Config) Authorize(req *http.Request) error {
 // parseBodyParams reads the body of req and parses it for query terms.  It
 // returns nil if there is no body, or the body does not contain query terms.
 func parseBodyParams(req *http.Request) url.Values {
-	// The expected content type of encoded form data. It is also possible to
-	// use multipart/form-data, but that seems uncommon in practice.
+	// The expected content type of encoded form data. The parameters of a
+	// multipart/form-data body are not included in the signature base string
+	// (RFC 5849 Section 3.4.1.3.1), so such a body is not read here.
 	const formDataType = "application/x-www-form-urlencoded"
 
 	if req.GetBody == nil || req.Header.Get("content-type") != formDataType {
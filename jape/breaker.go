@@ -0,0 +1,319 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default settings for a CircuitBreaker.
+const (
+	DefaultBreakerFailures  = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+	DefaultBreakerSuccesses = 1
+)
+
+// ErrCircuitOpen is the underlying error reported for a request that was not
+// sent because the circuit breaker for its endpoint is open. The concrete
+// error has type *CircuitOpenError, which matches ErrCircuitOpen under
+// errors.Is.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError is the error reported for a request rejected by an open
+// circuit breaker.
+type CircuitOpenError struct {
+	Endpoint string       // the endpoint of the rejected request
+	State    CircuitState // CircuitOpen or CircuitHalfOpen
+	Until    time.Time    // when the circuit will next admit a trial request
+}
+
+// Error implements the error interface.
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit %s for %s", e.State, e.Endpoint)
+}
+
+// Is reports whether target is ErrCircuitOpen.
+func (e *CircuitOpenError) Is(target error) bool { return target == ErrCircuitOpen }
+
+// CircuitState is the state of the circuit breaker for an endpoint.
+type CircuitState int
+
+// Constants for CircuitState.
+const (
+	CircuitClosed   CircuitState = iota // requests are sent normally
+	CircuitOpen                         // requests are rejected
+	CircuitHalfOpen                     // a trial request is permitted
+)
+
+var circuitNames = map[CircuitState]string{
+	CircuitClosed:   "closed",
+	CircuitOpen:     "open",
+	CircuitHalfOpen: "half-open",
+}
+
+func (s CircuitState) String() string {
+	if n, ok := circuitNames[s]; ok {
+		return n
+	}
+	return "CircuitState" + strconv.Itoa(int(s))
+}
+
+// A CircuitBreaker stops a client from sending requests to an endpoint that
+// is failing, keyed by endpoint (see the Endpoint method of Request). To use
+// a CircuitBreaker, set it as the Breaker of a client.
+//
+// The circuit for each endpoint is initially closed, and requests are sent
+// normally. A request fails if it could not be sent at the transport level, or
+// if the server reported a 5xx error other than 501 (Not Implemented); any
+// other response, including a 4xx error, is a success. When Failures requests
+// to an endpoint fail consecutively, its circuit opens.
+//
+// While a circuit is open, requests to its endpoint are rejected without
+// contacting the server, with an error wrapping a *CircuitOpenError. After
+// Cooldown has elapsed, the circuit is half-open, and admits one trial request
+// at a time. If Successes trial requests succeed consecutively, the circuit
+// closes; if a trial request fails, the circuit opens again.
+//
+// Each attempt of a retried request counts separately. Requests answered from
+// a Cache do not affect the breaker.
+//
+// A zero CircuitBreaker is ready for use with default settings. A
+// CircuitBreaker is safe for concurrent use by multiple goroutines, and may
+// be shared by multiple clients. Its settings must not be changed once it is
+// in use.
+type CircuitBreaker struct {
+	// The number of consecutive failures that opens a circuit.
+	// If zero, use DefaultBreakerFailures.
+	Failures int
+
+	// How long an open circuit rejects requests before admitting a trial.
+	// If zero, use DefaultBreakerCooldown.
+	Cooldown time.Duration
+
+	// The number of consecutive successful trials that closes a half-open
+	// circuit. If zero, use DefaultBreakerSuccesses.
+	Successes int
+
+	μ        sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state     CircuitState
+	failures  int       // consecutive failures while closed
+	successes int       // consecutive successes while half-open
+	until     time.Time // while open, when the cooldown ends
+	probing   bool      // while half-open, whether a trial is in progress
+}
+
+func (b *CircuitBreaker) failures() int {
+	if b.Failures <= 0 {
+		return DefaultBreakerFailures
+	}
+	return b.Failures
+}
+
+func (b *CircuitBreaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return DefaultBreakerCooldown
+	}
+	return b.Cooldown
+}
+
+func (b *CircuitBreaker) successes() int {
+	if b.Successes <= 0 {
+		return DefaultBreakerSuccesses
+	}
+	return b.Successes
+}
+
+// State reports the current state of the circuit for the specified endpoint,
+// for example "GET 2/tweets/search/recent".
+func (b *CircuitBreaker) State(endpoint string) CircuitState {
+	b.μ.Lock()
+	defer b.μ.Unlock()
+	if cc, ok := b.circuits[endpoint]; ok {
+		if cc.state == CircuitOpen && !time.Now().Before(cc.until) {
+			return CircuitHalfOpen
+		}
+		return cc.state
+	}
+	return CircuitClosed
+}
+
+// A stateChange records a transition of the circuit for an endpoint.
+type stateChange struct {
+	endpoint string
+	from, to CircuitState
+}
+
+// check reports a *CircuitOpenError if the circuit for endpoint is open and
+// its cooldown has not ended as of now. Unlike allow, it does not change the
+// state of the circuit or begin a trial.
+func (b *CircuitBreaker) check(endpoint string, now time.Time) error {
+	b.μ.Lock()
+	defer b.μ.Unlock()
+	if cc, ok := b.circuits[endpoint]; ok && cc.state == CircuitOpen && now.Before(cc.until) {
+		return &CircuitOpenError{Endpoint: endpoint, State: CircuitOpen, Until: cc.until}
+	}
+	return nil
+}
+
+// allow reports whether a request to endpoint may be sent. If so, the caller
+// must report the outcome of the request to done. Otherwise, allow returns a
+// *CircuitOpenError. In either case, allow reports any change in the state
+// of the circuit.
+func (b *CircuitBreaker) allow(endpoint string, now time.Time) (done func(outcome) *stateChange, change *stateChange, err error) {
+	b.μ.Lock()
+	defer b.μ.Unlock()
+	cc, ok := b.circuits[endpoint]
+	if !ok {
+		if b.circuits == nil {
+			b.circuits = make(map[string]*circuit)
+		}
+		cc = new(circuit)
+		b.circuits[endpoint] = cc
+	}
+	switch cc.state {
+	case CircuitOpen:
+		if now.Before(cc.until) {
+			return nil, nil, &CircuitOpenError{Endpoint: endpoint, State: CircuitOpen, Until: cc.until}
+		}
+		cc.state = CircuitHalfOpen
+		cc.successes = 0
+		change = &stateChange{endpoint, CircuitOpen, CircuitHalfOpen}
+		fallthrough
+	case CircuitHalfOpen:
+		if cc.probing {
+			return nil, change, &CircuitOpenError{Endpoint: endpoint, State: CircuitHalfOpen, Until: now}
+		}
+		cc.probing = true
+	}
+	var once sync.Once
+	return func(o outcome) (sc *stateChange) {
+		once.Do(func() { sc = b.record(endpoint, cc, o) })
+		return sc
+	}, change, nil
+}
+
+// An outcome classifies the result of a request for the circuit breaker.
+type outcome int
+
+const (
+	outcomeNeutral outcome = iota // neither success nor failure
+	outcomeSuccess
+	outcomeFailure
+)
+
+// requestOutcome classifies the result of sending a request.
+func requestOutcome(rsp *http.Response, err error) outcome {
+	if err != nil {
+		if !isContextError(err) && IsTransient(err) {
+			return outcomeFailure
+		}
+		return outcomeNeutral
+	}
+	if rsp.StatusCode >= 500 && rsp.StatusCode != http.StatusNotImplemented {
+		return outcomeFailure
+	}
+	return outcomeSuccess
+}
+
+// record updates the circuit for endpoint with the outcome of a request it
+// admitted, and reports any change in its state.
+func (b *CircuitBreaker) record(endpoint string, cc *circuit, o outcome) *stateChange {
+	b.μ.Lock()
+	defer b.μ.Unlock()
+	from := cc.state
+	switch cc.state {
+	case CircuitClosed:
+		switch o {
+		case outcomeSuccess:
+			cc.failures = 0
+		case outcomeFailure:
+			cc.failures++
+			if cc.failures >= b.failures() {
+				b.openLocked(cc)
+			}
+		}
+	case CircuitHalfOpen:
+		cc.probing = false
+		switch o {
+		case outcomeSuccess:
+			cc.successes++
+			if cc.successes >= b.successes() {
+				cc.state = CircuitClosed
+				cc.failures = 0
+			}
+		case outcomeFailure:
+			b.openLocked(cc)
+		}
+	}
+	if cc.state == from {
+		return nil
+	}
+	return &stateChange{endpoint, from, cc.state}
+}
+
+func (b *CircuitBreaker) openLocked(cc *circuit) {
+	cc.state = CircuitOpen
+	cc.until = time.Now().Add(b.cooldown())
+	cc.probing = false
+}
+
+// checkBreaker reports an error if c's circuit breaker would reject req
+// because its circuit is open, without beginning a trial.
+func (c *Client) checkBreaker(req *Request) error {
+	if c.Breaker == nil {
+		return nil
+	}
+	if err := c.Breaker.check(req.Endpoint(), time.Now()); err != nil {
+		return &Error{Message: "request not sent", Err: err}
+	}
+	return nil
+}
+
+// admitBreaker checks whether c's circuit breaker permits req to be sent. If
+// so, it returns a function the caller must call with the result of sending
+// the request. If c has no breaker, admitBreaker always permits the request.
+func (c *Client) admitBreaker(ctx context.Context, req *Request) (func(*http.Response, error), error) {
+	if c.Breaker == nil {
+		return func(*http.Response, error) {}, nil
+	}
+	done, change, err := c.Breaker.allow(req.Endpoint(), time.Now())
+	c.logStateChange(ctx, change)
+	if err != nil {
+		return nil, &Error{Message: "request not sent", Err: err}
+	}
+	return func(rsp *http.Response, err error) {
+		c.logStateChange(ctx, done(requestOutcome(rsp, err)))
+	}, nil
+}
+
+// logStateChange logs a change in the state of a circuit, if sc != nil.
+func (c *Client) logStateChange(ctx context.Context, sc *stateChange) {
+	if sc == nil {
+		return
+	}
+	if c.wantLog(LogCircuit) {
+		c.log(LogCircuit, fmt.Sprintf("circuit for %s changed from %s to %s", sc.endpoint, sc.from, sc.to))
+	}
+	if c.Logger != nil {
+		level := slog.LevelInfo
+		if sc.to == CircuitOpen {
+			level = slog.LevelWarn
+		}
+		c.Logger.LogAttrs(ctx, level, "circuit state changed",
+			slog.String("endpoint", sc.endpoint),
+			slog.String("from", sc.from.String()),
+			slog.String("to", sc.to.String()),
+		)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default size bounds for a Cache.
+const (
+	DefaultCacheEntries = 1024
+	DefaultCacheBytes   = 16 << 20
+)
+
+// A Cache holds the responses to GET requests, so that a client can answer
+// repeated requests for the same data without contacting the server. To use
+// a cache, set it as the Cache of a client and configure the lifetime of
+// responses for each endpoint to be cached:
+//
+//	cli.Cache = &jape.Cache{
+//	   TTLs: map[string]time.Duration{
+//	      "GET 2/users":               10 * time.Minute,
+//	      "GET 2/users/:id/followers": 2 * time.Minute,
+//	   },
+//	}
+//
+// Responses are keyed by the complete request, including its method path and
+// all its parameters (such as the requested fields and expansions), so that
+// requests differing in any parameter are cached separately.  Only successful
+// responses to Call and CallJSON requests are cached; streams and requests
+// with other HTTP methods are never cached.
+//
+// When the cache exceeds its size bounds, the least-recently used responses
+// are evicted. To skip the cache for a particular request, use BypassCache on
+// the context of the request. To remove stale responses, for example after
+// modifying a resource, use the Invalidate methods.
+//
+// Cached responses do not record which credentials or base URL were used to
+// fetch them, so a Cache must not be shared by clients with different
+// credentials or base URLs. The twitter package does not use the cache for a
+// call with options that change either of these.
+//
+// A Cache is safe for concurrent use by multiple goroutines.
+type Cache struct {
+	// The lifetime of cached responses for each endpoint, keyed by the
+	// endpoint string of the request (see the Endpoint method of Request).
+	TTLs map[string]time.Duration
+
+	// The lifetime of cached responses for endpoints not listed in TTLs.
+	// If zero, such responses are not cached.
+	TTL time.Duration
+
+	// The maximum number of responses to retain. If zero, use
+	// DefaultCacheEntries.
+	MaxEntries int
+
+	// The maximum total size in bytes of response bodies to retain. A response
+	// larger than this is not cached. If zero, use DefaultCacheBytes.
+	MaxBytes int64
+
+	μ       sync.Mutex
+	lru     *list.List               // front is most-recently used
+	entries map[string]*list.Element // key → *cacheEntry
+	size    int64                    // total body bytes
+}
+
+type cacheEntry struct {
+	key     string
+	req     Request // method path and parameters only
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+func (c *Cache) ttl(endpoint string) time.Duration {
+	if d, ok := c.TTLs[endpoint]; ok {
+		return d
+	}
+	return c.TTL
+}
+
+func (c *Cache) maxEntries() int {
+	if c.MaxEntries <= 0 {
+		return DefaultCacheEntries
+	}
+	return c.MaxEntries
+}
+
+func (c *Cache) maxBytes() int64 {
+	if c.MaxBytes <= 0 {
+		return DefaultCacheBytes
+	}
+	return c.MaxBytes
+}
+
+// get returns the unexpired entry for key, or nil.
+func (c *Cache) get(key string, now time.Time) *cacheEntry {
+	c.μ.Lock()
+	defer c.μ.Unlock()
+	elt, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := elt.Value.(*cacheEntry)
+	if !now.Before(e.expires) {
+		c.removeLocked(elt)
+		return nil
+	}
+	c.lru.MoveToFront(elt)
+	return e
+}
+
+// put adds e to the cache, evicting older entries as needed.
+func (c *Cache) put(e *cacheEntry) {
+	size := int64(len(e.body))
+	if size > c.maxBytes() {
+		return
+	}
+	c.μ.Lock()
+	defer c.μ.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.lru = list.New()
+	}
+	if old, ok := c.entries[e.key]; ok {
+		c.removeLocked(old)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += size
+	for c.lru.Len() > c.maxEntries() || c.size > c.maxBytes() {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *Cache) removeLocked(elt *list.Element) {
+	e := c.lru.Remove(elt).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.body))
+}
+
+// Len reports the number of responses currently in the cache, including any
+// that have expired but not yet been removed.
+func (c *Cache) Len() int {
+	c.μ.Lock()
+	defer c.μ.Unlock()
+	return len(c.entries)
+}
+
+// Invalidate removes the cached response for req, if there is one.
+func (c *Cache) Invalidate(req *Request) {
+	key := req.cacheKey()
+	c.μ.Lock()
+	defer c.μ.Unlock()
+	if elt, ok := c.entries[key]; ok {
+		c.removeLocked(elt)
+	}
+}
+
+// InvalidateEndpoint removes all cached responses for requests to the
+// specified endpoint, for example "GET 2/lists/:id".
+func (c *Cache) InvalidateEndpoint(endpoint string) {
+	c.InvalidateFunc(func(req *Request) bool { return req.Endpoint() == endpoint })
+}
+
+// InvalidateFunc removes all cached responses for which f reports true. The
+// request passed to f has only its Method, HTTPMethod, and Params populated,
+// and f must not modify it.
+func (c *Cache) InvalidateFunc(f func(*Request) bool) {
+	c.μ.Lock()
+	defer c.μ.Unlock()
+	for _, elt := range c.entries {
+		if f(&elt.Value.(*cacheEntry).req) {
+			c.removeLocked(elt)
+		}
+	}
+}
+
+// Clear removes all cached responses.
+func (c *Cache) Clear() {
+	c.μ.Lock()
+	defer c.μ.Unlock()
+	c.entries = nil
+	c.lru = nil
+	c.size = 0
+}
+
+type bypassCacheKey struct{}
+
+// BypassCache returns a copy of ctx that causes requests issued with it to
+// skip the lookup in a client's Cache, and always contact the server. A
+// successful response still replaces any cached response.
+func BypassCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheKey{}, true)
+}
+
+// cacheKey returns a string identifying the complete request.
+func (r *Request) cacheKey() string {
+	method := r.HTTPMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	return method + " " + r.Method + "?" + r.Params.Encode()
+}
+
+// isCacheable reports whether r is a GET request without a body or extra
+// headers, whose response may be cached or shared with other callers.
+func (r *Request) isCacheable() bool {
+	return (r.HTTPMethod == "" || r.HTTPMethod == http.MethodGet) &&
+		len(r.Data) == 0 && r.Multipart == nil && len(r.Header) == 0
+}
+
+// startCached is as startShared, but if c has a cache, it answers req from the
+// cache if possible, and arranges for a successful response to be cached.
+func (c *Client) startCached(ctx context.Context, req *Request) (*http.Response, error) {
+	if c.Cache == nil || !req.isCacheable() {
+		return c.startShared(ctx, req)
+	}
+	ttl := c.Cache.ttl(req.Endpoint())
+	if ttl <= 0 {
+		return c.startShared(ctx, req)
+	}
+
+	key := req.cacheKey()
+	if bypass, _ := ctx.Value(bypassCacheKey{}).(bool); !bypass {
+		if e := c.Cache.get(key, time.Now()); e != nil {
+			setSpanAttrs(ctx, slog.Bool("cache_hit", true))
+			return &http.Response{
+				Status:        "200 OK",
+				StatusCode:    http.StatusOK,
+				Header:        e.header.Clone(),
+				Body:          io.NopCloser(bytes.NewReader(e.body)),
+				ContentLength: int64(len(e.body)),
+			}, nil
+		}
+	}
+
+	rsp, err := c.startShared(ctx, req)
+	if err != nil || rsp.StatusCode != http.StatusOK {
+		return rsp, err
+	}
+	rsp.Body = &cacheFill{
+		ReadCloser: rsp.Body,
+		cache:      c.Cache,
+		limit:      c.Cache.maxBytes(),
+		entry: &cacheEntry{
+			key:    key,
+			req:    Request{Method: req.Method, HTTPMethod: req.HTTPMethod, Params: req.Params.Clone()},
+			header: rsp.Header.Clone(),
+		},
+		ttl: ttl,
+	}
+	return rsp, nil
+}
+
+// A cacheFill wraps a response body to capture its contents, and adds them to
+// the cache when the body has been completely read.
+type cacheFill struct {
+	io.ReadCloser
+	cache *Cache
+	entry *cacheEntry
+	ttl   time.Duration
+	limit int64
+	buf   bytes.Buffer
+	done  bool
+}
+
+func (f *cacheFill) Read(data []byte) (int, error) {
+	nr, err := f.ReadCloser.Read(data)
+	if f.done {
+		return nr, err
+	}
+	f.buf.Write(data[:nr])
+	if int64(f.buf.Len()) > f.limit {
+		f.done = true // too large to cache
+		f.buf = bytes.Buffer{}
+	} else if err == io.EOF {
+		f.done = true
+		f.entry.body = f.buf.Bytes()
+		f.entry.expires = time.Now().Add(f.ttl)
+		f.cache.put(f.entry)
+	}
+	return nr, err
+}
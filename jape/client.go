@@ -29,12 +29,16 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -50,7 +54,7 @@ type Client struct {
 
 	// If set, this is called prior to issuing the request to the API.  If it
 	// reports an error, the request is aborted and the error is returned to the
-	// caller.
+	// caller. Authorization is applied after any Interceptors have run.
 	Authorize func(*http.Request) error
 
 	// Defines the base URL for requests to the API.
@@ -62,6 +66,108 @@ type Client struct {
 
 	// If non-zero, only log tags in this mask are sent to the log function.
 	LogMask LogTag
+
+	// If set, the client writes a structured record to this logger for each
+	// request exchanged with the API, and for each retry.
+	Logger *slog.Logger
+
+	// By default, secrets such as authorization headers, OAuth parameters,
+	// and access tokens are redacted from log output. If LogSecrets is true,
+	// they are logged verbatim instead.
+	LogSecrets bool
+
+	// If set, this policy controls retrying of requests that fail with
+	// transient errors. If nil, requests are not retried.
+	Retry *RetryPolicy
+
+	// If set, this policy controls reconnection of streams that fail or are
+	// disconnected. If nil, a stream ends at the first disconnection.
+	Reconnect *ReconnectPolicy
+
+	// If positive, a stream that receives no data for this long is considered
+	// stalled, and is closed with an error wrapping ErrStreamStalled. Any data
+	// count, including the blank keep-alive lines sent by the server, which the
+	// Twitter API sends about every 20 seconds. If zero, streams do not time out.
+	StallTimeout time.Duration
+
+	// If set, this limiter is consulted before each request is sent, and is
+	// updated with the headers of each response received.
+	Limiter Limiter
+
+	// If true, ask the server to gzip-compress response bodies, and decompress
+	// them incrementally as they are read. This applies to both Call and
+	// Stream requests; message boundaries, keep-alives, and logging of stream
+	// messages are unaffected.
+	Compress bool
+
+	// If set, these counters are updated with the number of bytes sent and
+	// received by the client. With Compress set, they distinguish the number
+	// of bytes on the wire from the number after decompression.
+	Counters *TransferCounters
+
+	// If set, successful responses to GET requests made by Call and CallJSON
+	// are cached here, according to the policy of the cache.
+	Cache *Cache
+
+	// If set, identical GET requests made concurrently by Call and CallJSON
+	// are merged into a single request to the server.
+	Coalescer *Coalescer
+
+	// If set, this limit caps the number of requests in progress at once.
+	Concurrency *ConcurrencyLimit
+
+	// If set, this breaker stops requests to endpoints that are failing.
+	Breaker *CircuitBreaker
+
+	// If set, metrics for each request are recorded here.
+	Metrics *Metrics
+
+	// If set, this tracer is used to open a span for each Call, CallJSON, and
+	// Stream. Whether or not a tracer is set, each request carries a W3C
+	// traceparent header if its context identifies a trace.
+	Tracer Tracer
+
+	// If positive, the maximum size in bytes of a response body the client
+	// will read for a Call. A larger response is rejected with an error that
+	// wraps a *BodyTooLargeError. If zero, response bodies are not limited.
+	MaxBodySize int64
+
+	// If non-empty, these interceptors wrap each request sent to the API, in
+	// order, so that the first interceptor is the outermost. The built-in
+	// authorization and logging steps run after all these interceptors.
+	Interceptors []Interceptor
+
+	// If set, each Call, CallJSON, and Stream runs within this function, which
+	// must call run once with ctx or a context derived from it, and return
+	// the error reported by run or another *Error in its place. The context
+	// passed to run governs the whole call, including any waits for admission,
+	// retries, and reconnection.
+	Scope func(ctx context.Context, run func(context.Context) error) error
+
+	// If true, requests are not sent to the API. Instead, each Call,
+	// CallJSON, and Stream fails with an error wrapping an *Explanation that
+	// describes the request that would have been sent. See Explain.
+	DryRun bool
+}
+
+// A Limiter controls admission of requests to the API, for example to respect
+// rate limits reported by the server. A Limiter must be safe for concurrent
+// use by multiple goroutines.
+type Limiter interface {
+	// Admit is called before req is sent to the server. It may block until
+	// the request is permitted, or report an error to abort the request.
+	Admit(ctx context.Context, req *Request) error
+
+	// Update is called with the response headers of each reply to req.
+	Update(req *Request, h http.Header)
+}
+
+// scoped calls run with ctx, within the Scope of c if it has one.
+func (c *Client) scoped(ctx context.Context, run func(context.Context) error) error {
+	if c.Scope == nil {
+		return run(ctx)
+	}
+	return c.Scope(ctx, run)
 }
 
 func (c *Client) httpClient() *http.Client {
@@ -81,46 +187,102 @@ func (c *Client) wantLog(tag LogTag) bool {
 	return c.Log != nil && (c.LogMask == 0 || c.LogMask&tag != 0)
 }
 
+// redact returns s redacted by f, unless c.LogSecrets is true.
+func (c *Client) redact(f func(string) string, s string) string {
+	if c.LogSecrets {
+		return s
+	}
+	return f(s)
+}
+
+// redactBody returns data as a string, with secrets redacted unless
+// c.LogSecrets is true.
+func (c *Client) redactBody(data []byte) string {
+	if c.LogSecrets {
+		return string(data)
+	}
+	return RedactBody(data)
+}
+
 // start issues the specified API request and returns its HTTP response.  The
 // caller is responsible for interpreting any errors or unexpected status codes
 // from the request.
 func (c *Client) start(ctx context.Context, req *Request) (*http.Response, error) {
+	// Reject a request to an open circuit before it waits for admission, but
+	// do not ask the breaker for a trial until the request is ready to send,
+	// so that a trial is not held up by the limiter or a full semaphore.
+	if err := c.checkBreaker(req); err != nil {
+		return nil, err
+	}
+	if c.Limiter != nil {
+		if err := c.Limiter.Admit(ctx, req); err != nil {
+			return nil, &Error{Message: "request not admitted", Err: err}
+		}
+	}
+	hreq, err := c.newHTTPRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := c.Concurrency.acquire(ctx, req.Endpoint())
+	if err != nil {
+		return nil, &Error{Message: "waiting for a request slot", Err: err}
+	}
+	report, err := c.admitBreaker(ctx, req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	rsp, err := c.send(hreq)
+	report(rsp, err)
+	if err != nil {
+		release()
+		if _, ok := err.(*Error); ok {
+			return nil, err
+		}
+		return nil, &Error{Message: "interceptor", Err: err}
+	}
+	rsp.Body = releaseBody{ReadCloser: rsp.Body, release: release}
+	if c.Limiter != nil {
+		c.Limiter.Update(req, rsp.Header)
+	}
+	setSpanAttrs(ctx, slog.Int("status", rsp.StatusCode))
+	return rsp, nil
+}
+
+// newHTTPRequest constructs the HTTP request for req, whose context carries
+// req and any trace context from ctx.
+func (c *Client) newHTTPRequest(ctx context.Context, req *Request) (*http.Request, error) {
 	requestURL, err := req.URL(c.BaseURL)
 	if err != nil {
 		return nil, &Error{Message: "invalid request URL", Err: err}
 	}
-	c.log(LogRequestURL, requestURL)
 
 	data, dlen, dtype := req.Body()
-	hreq, err := http.NewRequestWithContext(ctx, req.HTTPMethod, requestURL, data)
+	rctx := context.WithValue(ctx, requestContextKey{}, req)
+	hreq, err := http.NewRequestWithContext(rctx, req.HTTPMethod, requestURL, data)
 	if err != nil {
 		return nil, &Error{Message: "invalid request", Err: err}
 	}
 	hreq.ContentLength = dlen
-	if dlen > 0 {
+	if data != nil {
 		hreq.Header.Set("Content-Type", dtype)
 	}
-
-	if auth := c.Authorize; auth != nil {
-		if err := auth(hreq); err != nil {
-			return nil, &Error{Message: "attaching authorization", Err: err}
-		}
-		if c.wantLog(LogAuthorization) {
-			c.log(LogAuthorization, hreq.Header.Get("authorization"))
-		}
-	}
-
-	rsp, err := c.httpClient().Do(hreq)
-	if err != nil {
-		return nil, &Error{Message: "issuing request", Err: err}
+	for name, vals := range req.Header {
+		hreq.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), vals...)
 	}
-	return rsp, nil
+	setTraceParent(hreq)
+	return hreq, nil
 }
 
 // ErrStopStreaming is a sentinel error that a stream callback can use to
 // signal it does not want any further results.
 var ErrStopStreaming = errors.New("stop streaming")
 
+// ErrStreamStalled is the underlying error reported when a stream is closed
+// because no data arrived within the client's StallTimeout.
+var ErrStreamStalled = errors.New("stream stalled")
+
 // A Callback function is invoked for each reply received in a stream.  If the
 // callback reports a non-nil error, the stream is terminated. If the error is
 // anything other than ErrStopStreaming, it is reported to the caller.
@@ -135,59 +297,296 @@ func (c *Client) receive(rsp *http.Response) (http.Header, []byte, error) {
 	}
 	// The body must be fully read and closed to avoid orphaning resources.
 	// See: https://godoc.org/net/http#Do
+	defer rsp.Body.Close()
+	if err := c.checkSize(rsp); err != nil {
+		return rsp.Header, nil, err
+	}
 	var body bytes.Buffer
-	io.Copy(&body, rsp.Body)
-	rsp.Body.Close()
-	c.log(LogHTTPStatus, rsp.Status)
+	_, err := io.Copy(&body, c.limitBody(rsp.Body))
 	if c.wantLog(LogResponseBody) {
-		c.log(LogResponseBody, body.String())
+		c.log(LogResponseBody, c.redactBody(body.Bytes()))
 	}
-	switch rsp.StatusCode {
-	case http.StatusOK, http.StatusCreated:
-		// ok
-	default:
-		return rsp.Header, nil, &Error{
+	if serr := statusError(rsp, body.Bytes()); serr != nil {
+		return rsp.Header, nil, serr
+	} else if errors.As(err, new(*BodyTooLargeError)) {
+		return rsp.Header, nil, &Error{Message: "reading response body", Err: err}
+	}
+	return rsp.Header, body.Bytes(), nil
+}
+
+// decode checks the status of a successful (non-nil) HTTP response returned
+// by a call to start, and decodes its body as JSON into v as it is read (see
+// decodeJSON). It returns the response headers.
+func (c *Client) decode(rsp *http.Response, v any) (http.Header, error) {
+	if rsp == nil { // safety check
+		panic("cannot decode a nil *http.Response")
+	}
+	if !isOKStatus(rsp.StatusCode) {
+		header, _, err := c.receive(rsp)
+		return header, err
+	}
+	defer rsp.Body.Close()
+	if err := c.checkSize(rsp); err != nil {
+		return rsp.Header, err
+	}
+	r := c.limitBody(rsp.Body)
+	var logBuf *bytes.Buffer
+	if c.wantLog(LogResponseBody) {
+		logBuf = new(bytes.Buffer)
+		r = io.TeeReader(r, logBuf)
+	}
+
+	dec := json.NewDecoder(r)
+	err := decodeJSON(dec, v)
+	if err == nil {
+		// Make sure there is nothing but whitespace after the value, as
+		// json.Unmarshal would. This also drains the body, so the connection
+		// can be reused.
+		if _, terr := dec.Token(); terr != io.EOF {
+			err = errTrailingData
+		}
+	}
+	if logBuf != nil {
+		c.log(LogResponseBody, c.redactBody(logBuf.Bytes()))
+	}
+	if errors.As(err, new(*BodyTooLargeError)) {
+		return rsp.Header, &Error{Message: "reading response body", Err: err}
+	} else if err != nil {
+		return rsp.Header, &Error{Message: "decoding response body", Err: err}
+	}
+	return rsp.Header, nil
+}
+
+func isOKStatus(code int) bool { return code == http.StatusOK || code == http.StatusCreated }
+
+// statusError returns an error for rsp if its status does not indicate
+// success, or nil. The data are the contents of the response body.
+func statusError(rsp *http.Response, data []byte) error {
+	if isOKStatus(rsp.StatusCode) {
+		return nil
+	}
+	return &Error{
+		Status:  rsp.StatusCode,
+		Data:    data,
+		Message: "request failed: " + rsp.Status,
+		Problem: decodeProblem(rsp.Header.Get("Content-Type"), data),
+	}
+}
+
+// checkSize reports an error if rsp declares a content length greater than
+// the client's MaxBodySize.
+func (c *Client) checkSize(rsp *http.Response) error {
+	if c.MaxBodySize > 0 && rsp.ContentLength > c.MaxBodySize {
+		return &Error{
 			Status:  rsp.StatusCode,
-			Data:    body.Bytes(),
-			Message: "request failed: " + rsp.Status,
+			Message: "reading response body",
+			Err:     &BodyTooLargeError{Limit: c.MaxBodySize, Size: rsp.ContentLength},
 		}
 	}
-	return rsp.Header, body.Bytes(), nil
+	return nil
+}
+
+// limitBody returns a reader for body that enforces the client's MaxBodySize.
+func (c *Client) limitBody(body io.Reader) io.Reader {
+	if c.MaxBodySize <= 0 {
+		return body
+	}
+	return &maxBytesReader{r: body, left: c.MaxBodySize, limit: c.MaxBodySize}
+}
+
+// A maxBytesReader delivers the contents of r, and reports an error if r
+// delivers more than limit bytes.
+type maxBytesReader struct {
+	r           io.Reader
+	left, limit int64
+}
+
+func (m *maxBytesReader) Read(data []byte) (int, error) {
+	if m.left < 0 {
+		return 0, &BodyTooLargeError{Limit: m.limit, Size: -1}
+	} else if len(data) == 0 {
+		return 0, nil
+	} else if int64(len(data)) > m.left+1 {
+		data = data[:m.left+1] // read one extra byte to detect overflow
+	}
+	nr, err := m.r.Read(data)
+	if int64(nr) <= m.left {
+		m.left -= int64(nr)
+		return nr, err
+	}
+	nr = int(m.left)
+	m.left = -1
+	return nr, &BodyTooLargeError{Limit: m.limit, Size: -1}
 }
 
 // Call issues the specified API request and returns the HTTP response headers
 // and response body without decoding. Errors from Call have type *jape.Error.
-func (c *Client) Call(ctx context.Context, req *Request) (http.Header, []byte, error) {
-	hrsp, err := c.start(ctx, req)
+//
+// If c has a retry policy, requests that fail with transient errors are
+// retried according to that policy.
+func (c *Client) Call(ctx context.Context, req *Request) (header http.Header, body []byte, err error) {
+	if c.DryRun {
+		return nil, nil, c.explain(ctx, req)
+	}
+	err = c.scoped(ctx, func(ctx context.Context) (err error) {
+		header, body, err = c.retryCall(ctx, req)
+		return err
+	})
+	return header, body, err
+}
+
+func (c *Client) retryCall(ctx context.Context, req *Request) (http.Header, []byte, error) {
+	ctx, span := c.startSpan(ctx, "jape.Call", req)
+	for attempt := 1; ; attempt++ {
+		header, body, err := c.call(ctx, req)
+		if err == nil {
+			endSpan(span, nil)
+			return header, body, nil
+		}
+		if err := c.waitRetry(ctx, attempt, req, header, err); err != nil {
+			endSpan(span, err)
+			return header, body, err
+		}
+	}
+}
+
+func (c *Client) call(ctx context.Context, req *Request) (http.Header, []byte, error) {
+	hrsp, err := c.startCached(ctx, req)
 	if err != nil {
 		return nil, nil, err
 	}
 	return c.receive(hrsp)
 }
 
-// stream streams results from a successful (non-nil) HTTP response returned by
-// a call to start. Results are delivered to the given callback until the
-// stream ends, ctx ends, or the callback reports a non-nil error.  The error
-// from the callback is propagated to the caller of stream.
-func (c *Client) stream(ctx context.Context, rsp *http.Response, f Callback) error {
+// CallJSON issues the specified API request and decodes the JSON response body
+// into v, which must be a pointer. It returns the HTTP response headers.
+// Errors from CallJSON have type *jape.Error.
+//
+// If v points to a struct, the fields of the response object are decoded one
+// at a time as the body is read, so the body is not buffered in addition to
+// the result. Each field value is still buffered before it is decoded, so this
+// saves little memory if most of the body is in one field, or if the fields
+// are themselves raw JSON.
+//
+// If c has a retry policy, requests that fail with transient errors are
+// retried according to that policy. A failure to decode the response body is
+// not retried.
+func (c *Client) CallJSON(ctx context.Context, req *Request, v any) (header http.Header, err error) {
+	if c.DryRun {
+		return nil, c.explain(ctx, req)
+	}
+	err = c.scoped(ctx, func(ctx context.Context) (err error) {
+		header, err = c.retryCallJSON(ctx, req, v)
+		return err
+	})
+	return header, err
+}
+
+func (c *Client) retryCallJSON(ctx context.Context, req *Request, v any) (http.Header, error) {
+	ctx, span := c.startSpan(ctx, "jape.CallJSON", req)
+	for attempt := 1; ; attempt++ {
+		header, err := c.callJSON(ctx, req, v)
+		if err == nil {
+			endSpan(span, nil)
+			return header, nil
+		}
+		if err := c.waitRetry(ctx, attempt, req, header, err); err != nil {
+			endSpan(span, err)
+			return header, err
+		}
+	}
+}
+
+func (c *Client) callJSON(ctx context.Context, req *Request, v any) (http.Header, error) {
+	hrsp, err := c.startCached(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.decode(hrsp, v)
+}
+
+// waitRetry reports whether req should be retried after the specified attempt
+// failed with err. If so, waitRetry waits for the retry delay and returns nil.
+// Otherwise, it returns the error that should be reported to the caller.
+func (c *Client) waitRetry(ctx context.Context, attempt int, req *Request, h http.Header, err error) error {
+	delay, ok := c.Retry.retryDelay(attempt, req, h, err)
+	if !ok {
+		return err
+	}
+	if c.wantLog(LogRetry) {
+		c.log(LogRetry, fmt.Sprintf("attempt %d failed (%v); retrying in %v", attempt, err, delay))
+	}
+	if c.Logger != nil {
+		c.Logger.LogAttrs(ctx, slog.LevelWarn, "retrying request",
+			slog.String("endpoint", req.Endpoint()),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.Any("error", err),
+		)
+	}
+	if serr := sleep(ctx, delay); serr != nil {
+		return &Error{Message: "waiting to retry", Err: serr}
+	}
+	setSpanAttrs(ctx, slog.Int("attempt", attempt+1))
+	return nil
+}
+
+// checkStream checks the status of a successful (non-nil) HTTP response
+// returned by a call to start for a stream request. If the status is not OK,
+// the response body is fully read and closed, and the response is returned
+// along with an error describing the failure.
+func (c *Client) checkStream(rsp *http.Response) (*http.Response, error) {
 	if rsp == nil { // safety check
 		panic("cannot stream a nil *http.Response")
 	}
-	body := rsp.Body
-	defer body.Close()
+	if rsp.StatusCode == http.StatusOK {
+		return rsp, nil
+	}
+	data, _ := io.ReadAll(c.limitBody(rsp.Body))
+	rsp.Body.Close()
+	if c.wantLog(LogResponseBody) {
+		c.log(LogResponseBody, c.redactBody(data))
+	}
+	return rsp, &Error{
+		Status:  rsp.StatusCode,
+		Data:    data,
+		Message: "request failed: " + rsp.Status,
+		Problem: decodeProblem(rsp.Header.Get("Content-Type"), data),
+	}
+}
 
-	c.log(LogHTTPStatus, rsp.Status)
-	if rsp.StatusCode != http.StatusOK {
-		data, _ := io.ReadAll(body)
-		if c.wantLog(LogResponseBody) {
-			c.log(LogResponseBody, string(data))
+// openStream issues the specified stream request and checks its status,
+// retrying transient failures according to the client's retry policy.
+func (c *Client) openStream(ctx context.Context, req *Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		hrsp, err := c.start(ctx, req)
+		if err == nil {
+			hrsp, err = c.checkStream(hrsp)
+			if err == nil {
+				return hrsp, nil
+			}
 		}
-		return &Error{
-			Status:  rsp.StatusCode,
-			Data:    data,
-			Message: "request failed: " + rsp.Status,
+		var h http.Header
+		if hrsp != nil {
+			h = hrsp.Header
+		}
+		if err := c.waitRetry(ctx, attempt, req, h, err); err != nil {
+			return nil, err
 		}
 	}
+}
+
+// stream streams results from a successful (non-nil) HTTP response returned
+// by openStream. Results are delivered to the given callback until the stream
+// ends, ctx ends, or the callback reports a non-nil error.  The error from the
+// callback is propagated to the caller of stream.
+func (c *Client) stream(ctx context.Context, req *Request, rsp *http.Response, f Callback) error {
+	if rsp == nil { // safety check
+		panic("cannot stream a nil *http.Response")
+	}
+	body := rsp.Body
+	defer body.Close()
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -197,33 +596,89 @@ func (c *Client) stream(ctx context.Context, rsp *http.Response, f Callback) err
 		body.Close()
 	}()
 
-	dec := json.NewDecoder(body)
+	// If a stall timeout is set, close the body to unblock the reader if no
+	// data (including keep-alives) arrive within the timeout.
+	var stalled atomic.Bool
+	watch := newWatchdog(c.StallTimeout, func() {
+		stalled.Store(true)
+		body.Close()
+	})
+	defer watch.stop()
+
+	dec := json.NewDecoder(watch.reader(body))
 	for {
 		var next json.RawMessage
 		if err := dec.Decode(&next); err == io.EOF {
 			break
 		} else if err != nil {
+			if stalled.Load() {
+				return &Error{Message: fmt.Sprintf("no data for %v", c.StallTimeout), Err: ErrStreamStalled}
+			}
 			return &Error{Message: "decoding message from stream", Err: err}
 		}
 		if c.wantLog(LogStreamBody) {
 			c.log(LogStreamBody, string(next))
 		}
+		c.Metrics.streamMessage(req)
+
+		// Pause the watchdog while the callback runs, so that a slow callback
+		// is not mistaken for a stalled stream.
+		watch.stop()
 		if err := f(next); err != nil {
 			return &Error{Message: "callback", Err: err}
 		}
+		watch.reset()
 	}
 	return nil
 }
 
 // Stream issues the specified API request and streams results to the given
 // callback. Errors from Stream have concrete type *jape.Error.
+//
+// If c has a reconnect policy, the stream is re-established according to that
+// policy when it fails or is disconnected. Otherwise, if c has a retry policy,
+// failures to establish the stream are retried according to that policy, but
+// once the stream has been established a failure terminates the stream.
 func (c *Client) Stream(ctx context.Context, req *Request, f Callback) error {
-	hrsp, err := c.start(ctx, req)
+	if c.DryRun {
+		return c.explain(ctx, req)
+	}
+	return c.scoped(ctx, func(ctx context.Context) error {
+		return c.tracedStream(ctx, req, f)
+	})
+}
+
+func (c *Client) tracedStream(ctx context.Context, req *Request, f Callback) error {
+	ctx, span := c.startSpan(ctx, "jape.Stream", req)
+	if span == nil {
+		return c.runStream(ctx, req, f)
+	}
+	var nmsg int
+	err := c.runStream(ctx, req, func(msg []byte) error {
+		nmsg++
+		return f(msg)
+	})
+	span.SetAttributes(slog.Int("messages", nmsg))
+	endSpan(span, err)
+	return err
+}
+
+func (c *Client) runStream(ctx context.Context, req *Request, f Callback) error {
+	if c.Reconnect != nil {
+		return c.reconnectStream(ctx, req, f)
+	}
+	hrsp, err := c.openStream(ctx, req)
 	if err != nil {
 		return err
 	}
-	if err := c.stream(ctx, hrsp, f); errors.Is(err, ErrStopStreaming) {
-		return nil // the callback requested a stop
+	return streamResult(c.stream(ctx, req, hrsp, f))
+}
+
+// streamResult converts an error reported by stream into the error reported
+// to the caller of Stream.
+func streamResult(err error) error {
+	if err == nil || errors.Is(err, ErrStopStreaming) {
+		return nil // the stream ended, or the callback requested a stop
 	} else if !errors.Is(err, io.EOF) {
 		if _, ok := err.(*Error); ok {
 			return err
@@ -254,6 +709,12 @@ type Request struct {
 	// For example: "service/method/12345".
 	Method string
 
+	// If set, the method path with its variable components replaced by named
+	// placeholders, for example "2/users/:id/followers". Endpoint uses this in
+	// place of Method, so that requests for different keys share the same
+	// per-endpoint rate limits, metrics, and other state.
+	Template string
+
 	// Additional request parameters, including optional fields and expansions.
 	Params Params
 
@@ -267,6 +728,33 @@ type Request struct {
 	// If unset, the value defaults to DefaultContentType (JSON).
 	// A content-type is only set if Data is non-empty.
 	ContentType string
+
+	// If non-empty, these headers are set on the HTTP request, replacing any
+	// values set by the client for the same names. Authorization is applied
+	// after these headers are set. A request with headers is not cached or
+	// coalesced.
+	Header http.Header
+
+	// If set, send these parts as a multipart/form-data request body.
+	// This takes precedence over Data and ContentType.
+	Multipart *Multipart
+
+	// If true, the request may be retried under the client's retry policy even
+	// if its HTTP method is not idempotent. Requests using GET, DELETE, or PUT
+	// are eligible for retry regardless of this setting.
+	Retryable bool
+}
+
+// canRetry reports whether r is eligible to be retried.
+func (r *Request) canRetry() bool {
+	switch r.HTTPMethod {
+	case "", http.MethodGet, http.MethodDelete, http.MethodPut:
+	default:
+		if !r.Retryable {
+			return false
+		}
+	}
+	return r.Multipart == nil || r.Multipart.canRetry()
 }
 
 // SetBodyToParams encodes r.Params in the request body.  This replaces the
@@ -277,6 +765,49 @@ func (r *Request) SetBodyToParams() {
 	r.Params = nil
 }
 
+// Endpoint returns a string identifying the API endpoint targeted by r. This
+// consists of the HTTP method and the method path. If r has a Template, it is
+// used as the path. Otherwise, numeric ID components of the path (after the
+// first) are replaced by ":id", and a component following "username" by
+// ":username". For example, a GET request for the method "2/users/12/followers"
+// has endpoint "GET 2/users/:id/followers".
+func (r *Request) Endpoint() string {
+	method := r.HTTPMethod
+	if method == "" {
+		method = http.MethodGet
+	}
+	if r.Template != "" {
+		return method + " " + r.Template
+	}
+	parts := strings.Split(r.Method, "/")
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+		if parts[i-1] == "username" && part != "" {
+			parts[i] = ":username"
+			continue
+		}
+
+		// Match an ID, possibly followed by an extension, e.g., "12345.json".
+		n := strings.IndexFunc(part, func(c rune) bool { return c < '0' || c > '9' })
+		if n < 0 && part != "" {
+			parts[i] = ":id"
+		} else if n > 0 && part[n] == '.' && isWord(part[n+1:]) {
+			parts[i] = ":id" + part[n:]
+		}
+	}
+	return method + " " + strings.Join(parts, "/")
+}
+
+// isWord reports whether s is a non-empty string of ASCII letters.
+func isWord(s string) bool {
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return s != ""
+}
+
 // URL returns the complete request URL for r, using base as the base URL.
 func (r *Request) URL(base string) (string, error) {
 	u, err := url.Parse(base)
@@ -291,8 +822,17 @@ func (r *Request) URL(base string) (string, error) {
 // Body returns the size and putative content-type of the request body, along
 // with a reader that will deliver its contents.
 //
+// If r has a Multipart body, data streams the encoded parts and size is -1 if
+// the size of any part is not known in advance. Each call to Body returns a
+// new reader, and a reader that is not read does not open any of the parts.
+// The caller must close the reader if it is not passed to an HTTP client.
+//
 // If no data are set on the request, Body returns nil, 0, "".
 func (r *Request) Body() (data io.Reader, size int64, ctype string) {
+	if r.Multipart != nil {
+		ctype = r.Multipart.contentType()
+		return r.Multipart.reader(), r.Multipart.size(), ctype
+	}
 	if len(r.Data) == 0 {
 		return nil, 0, ""
 	}
@@ -325,6 +865,19 @@ func (p Params) Set(name, value string) { p[name] = []string{value} }
 // Reset removes any existing values for the specified parameter.
 func (p Params) Reset(name string) { delete(p, name) }
 
+// Clone returns a copy of p that shares no storage with p.
+// If p == nil, Clone returns nil.
+func (p Params) Clone() Params {
+	if p == nil {
+		return nil
+	}
+	out := make(Params, len(p))
+	for name, vals := range p {
+		out[name] = append([]string(nil), vals...)
+	}
+	return out
+}
+
 // Encode encodes p as a query string. If len(p) == 0, Encode returns "".
 func (p Params) Encode() string {
 	query := make(url.Values)
@@ -356,7 +909,7 @@ type LogTag int
 const (
 	// The request URL sent to the server
 	LogRequestURL LogTag = 1 << iota
-	// The contents of the HTTP Authorization header
+	// The contents of the HTTP Authorization header (redacted by default)
 	LogAuthorization
 	// The HTTP status string (e.g., "200 OK")
 	LogHTTPStatus
@@ -364,6 +917,10 @@ const (
 	LogResponseBody
 	// The body of a stream response from the server
 	LogStreamBody
+	// A failed request that is being retried
+	LogRetry
+	// A change in the state of a circuit breaker
+	LogCircuit
 )
 
 var tagNames = map[LogTag]string{
@@ -372,6 +929,8 @@ var tagNames = map[LogTag]string{
 	LogHTTPStatus:    "HTTPStatus",
 	LogResponseBody:  "ResponseBody",
 	LogStreamBody:    "StreamBody",
+	LogRetry:         "Retry",
+	LogCircuit:       "Circuit",
 }
 
 func (t LogTag) String() string {
@@ -0,0 +1,1458 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/creachadair/twitter/jape"
+)
+
+// newTestServer starts an HTTP test server running h, and returns a client
+// configured to talk to it. The server is closed when t ends.
+func newTestServer(t testing.TB, h http.HandlerFunc) *jape.Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return &jape.Client{
+		HTTPClient: srv.Client(),
+		BaseURL:    srv.URL,
+		Log: func(tag jape.LogTag, msg string) {
+			t.Logf("%s | %s", tag, msg)
+		},
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	policy := &jape.RetryPolicy{MaxAttempts: 3, MinDelay: time.Millisecond}
+
+	// flaky returns a handler that fails with the given status the first n
+	// times it is called, and thereafter succeeds.
+	flaky := func(n int32, status int, calls *int32) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(calls, 1) <= n {
+				w.Header().Set("Retry-After", "0")
+				http.Error(w, "try again", status)
+				return
+			}
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}
+
+	t.Run("Recovers", func(t *testing.T) {
+		var calls int32
+		cli := newTestServer(t, flaky(2, http.StatusServiceUnavailable, &calls))
+		cli.Retry = policy
+		if _, body, err := cli.Call(ctx, &jape.Request{Method: "ok"}); err != nil {
+			t.Errorf("Call failed: %v", err)
+		} else if got := string(body); got != `{"ok":true}` {
+			t.Errorf("Call: got body %q", got)
+		}
+		if calls != 3 {
+			t.Errorf("Got %d calls, want 3", calls)
+		}
+	})
+
+	t.Run("GivesUp", func(t *testing.T) {
+		var calls int32
+		cli := newTestServer(t, flaky(5, http.StatusTooManyRequests, &calls))
+		cli.Retry = policy
+		_, _, err := cli.Call(ctx, &jape.Request{Method: "ok"})
+		var jerr *jape.Error
+		if !errors.As(err, &jerr) || jerr.Status != http.StatusTooManyRequests {
+			t.Errorf("Call: got error %v, want status 429", err)
+		}
+		if calls != 3 {
+			t.Errorf("Got %d calls, want 3", calls)
+		}
+	})
+
+	t.Run("NotIdempotent", func(t *testing.T) {
+		var calls int32
+		cli := newTestServer(t, flaky(1, http.StatusBadGateway, &calls))
+		cli.Retry = policy
+		if _, _, err := cli.Call(ctx, &jape.Request{Method: "ok", HTTPMethod: "POST"}); err == nil {
+			t.Error("Call: got nil error, want failure")
+		}
+		if calls != 1 {
+			t.Errorf("Got %d calls, want 1", calls)
+		}
+
+		atomic.StoreInt32(&calls, 0)
+		if _, _, err := cli.Call(ctx, &jape.Request{
+			Method:     "ok",
+			HTTPMethod: "POST",
+			Retryable:  true,
+		}); err != nil {
+			t.Errorf("Call failed: %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("Got %d calls, want 2", calls)
+		}
+	})
+
+	t.Run("Transport", func(t *testing.T) {
+		var calls int32
+		cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				// Drop the connection without a response.
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.Write([]byte(`{"ok":true}`))
+		})
+		if _, _, err := cli.Call(ctx, &jape.Request{Method: "ok"}); !errors.Is(err, jape.ErrTransport) {
+			t.Errorf("Call: got error %v, want %v", err, jape.ErrTransport)
+		} else if !jape.IsTransient(err) {
+			t.Errorf("IsTransient(%v): got false, want true", err)
+		}
+
+		atomic.StoreInt32(&calls, 0)
+		cli.Retry = policy
+		if _, _, err := cli.Call(ctx, &jape.Request{Method: "ok"}); err != nil {
+			t.Errorf("Call failed: %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("Got %d calls, want 2", calls)
+		}
+	})
+
+	t.Run("NoPolicy", func(t *testing.T) {
+		var calls int32
+		cli := newTestServer(t, flaky(1, http.StatusServiceUnavailable, &calls))
+		if _, _, err := cli.Call(ctx, &jape.Request{Method: "ok"}); err == nil {
+			t.Error("Call: got nil error, want failure")
+		}
+		if calls != 1 {
+			t.Errorf("Got %d calls, want 1", calls)
+		}
+	})
+}
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		method, path, template string
+		want                   string
+	}{
+		{"", "2/tweets", "", "GET 2/tweets"},
+		{"GET", "2/users/12/followers", "", "GET 2/users/:id/followers"},
+		{"DELETE", "2/users/12/likes/1297524288245895168", "", "DELETE 2/users/:id/likes/:id"},
+		{"POST", "1.1/statuses/destroy/12345.json", "", "POST 1.1/statuses/destroy/:id.json"},
+		{"GET", "1.1/lists/members.json", "", "GET 1.1/lists/members.json"},
+		{"GET", "2/users/by/username/jack", "", "GET 2/users/by/username/:username"},
+		{"GET", "2/users/jack/followers", "2/users/:id/followers", "GET 2/users/:id/followers"},
+		{"POST", "2/things/abc", "2/things/:key", "POST 2/things/:key"},
+	}
+	for _, test := range tests {
+		req := &jape.Request{Method: test.path, Template: test.template, HTTPMethod: test.method}
+		if got := req.Endpoint(); got != test.want {
+			t.Errorf("Endpoint %q %q: got %q, want %q", test.method, test.path, got, test.want)
+		}
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if got := req.Header.Get("Authorization"); got != "Bearer xyzzy" {
+			t.Errorf("Authorization: got %q, want %q", got, "Bearer xyzzy")
+		}
+		w.Header().Set("X-Order", req.Header.Get("X-Order"))
+		if req.URL.Path == "/stream" {
+			w.Write([]byte("{\"n\":1}\r\n{\"n\":2}\r\n"))
+		} else {
+			w.Write([]byte(`{}`))
+		}
+	})
+	cli.Authorize = jape.BearerTokenAuthorizer("xyzzy")
+
+	var log []string
+	trace := func(tag string) jape.Interceptor {
+		return func(hreq *http.Request, next jape.Handler) (*http.Response, error) {
+			if req := jape.RequestFromContext(hreq.Context()); req == nil {
+				t.Errorf("Interceptor %s: missing request in context", tag)
+			} else {
+				log = append(log, tag+" "+req.Method)
+			}
+			hreq.Header.Add("X-Order", tag)
+			return next(hreq)
+		}
+	}
+	cli.Interceptors = []jape.Interceptor{trace("A"), trace("B"), jape.SetHeader("X-Test", "ok")}
+
+	ctx := context.Background()
+	h, _, err := cli.Call(ctx, &jape.Request{Method: "call"})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if got := h.Get("X-Order"); got != "A" {
+		t.Errorf("Call X-Order: got %q, want A", got)
+	}
+
+	var nr int
+	if err := cli.Stream(ctx, &jape.Request{Method: "stream"}, func([]byte) error {
+		nr++
+		return nil
+	}); err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if nr != 2 {
+		t.Errorf("Stream: got %d messages, want 2", nr)
+	}
+
+	want := []string{"A call", "B call", "A stream", "B stream"}
+	if len(log) != len(want) {
+		t.Fatalf("Interceptor log: got %q, want %q", log, want)
+	}
+	for i := range want {
+		if log[i] != want[i] {
+			t.Errorf("Interceptor log [%d]: got %q, want %q", i, log[i], want[i])
+		}
+	}
+
+	// An interceptor may short-circuit the request.
+	cli.Interceptors = []jape.Interceptor{
+		func(*http.Request, jape.Handler) (*http.Response, error) {
+			return nil, errors.New("bogus")
+		},
+	}
+	if _, _, err := cli.Call(ctx, &jape.Request{Method: "call"}); err == nil {
+		t.Error("Call: got nil error, want failure")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	const token = "this-is-a-secret-token"
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("x-rate-limit-remaining", "17")
+		w.Write([]byte(`{"access_token":"` + token + `"}`))
+	})
+	cli.Authorize = jape.BearerTokenAuthorizer(token)
+
+	var logText strings.Builder
+	cli.Log = func(tag jape.LogTag, msg string) { fmt.Fprintf(&logText, "%s | %s\n", tag, msg) }
+
+	var buf bytes.Buffer
+	cli.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	if _, _, err := cli.Call(context.Background(), &jape.Request{Method: "2/users/12"}); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if strings.Contains(logText.String(), token) {
+		t.Errorf("Log contains secret token:\n%s", logText.String())
+	}
+
+	var rec struct {
+		Msg       string `json:"msg"`
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		Endpoint  string `json:"endpoint"`
+		Status    int    `json:"status"`
+		Received  int64  `json:"bytes_received"`
+		Remaining *int   `json:"rate_limit_remaining"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("Decoding log record %q: %v", buf.String(), err)
+	}
+	if rec.Msg != "request" || rec.Method != "GET" || rec.Path != "/2/users/12" ||
+		rec.Endpoint != "GET 2/users/:id" || rec.Status != 200 || rec.Received == 0 ||
+		rec.Remaining == nil || *rec.Remaining != 17 {
+		t.Errorf("Unexpected log record: %s", buf.String())
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	// The server fails the first request with a server error, then delivers
+	// one message and disconnects on each subsequent request.
+	var calls int32
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "{\"n\":%d}\r\n", n)
+	})
+
+	var events []string
+	cli.Reconnect = &jape.ReconnectPolicy{
+		NetworkDelay: time.Millisecond,
+		HTTPDelay:    time.Millisecond,
+		OnEvent: func(e jape.StreamEvent) {
+			events = append(events, e.Type.String())
+		},
+	}
+
+	var got []string
+	err := cli.Stream(context.Background(), &jape.Request{Method: "stream"}, func(msg []byte) error {
+		got = append(got, string(msg))
+		if len(got) == 3 {
+			return jape.ErrStopStreaming
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Stream failed: %v", err)
+	}
+	if want := `{"n":2} {"n":3} {"n":4}`; strings.Join(got, " ") != want {
+		t.Errorf("Messages: got %q, want %q", got, want)
+	}
+	want := "Retrying Connected Disconnected Retrying Connected Disconnected Retrying Connected"
+	if s := strings.Join(events, " "); s != want {
+		t.Errorf("Events:\ngot:  %s\nwant: %s", s, want)
+	}
+
+	// A client error is not retried.
+	cli = newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "go away", http.StatusUnauthorized)
+	})
+	cli.Reconnect = &jape.ReconnectPolicy{HTTPDelay: time.Millisecond}
+	err = cli.Stream(context.Background(), &jape.Request{Method: "stream"}, func([]byte) error {
+		t.Error("Unexpected callback")
+		return nil
+	})
+	var jerr *jape.Error
+	if !errors.As(err, &jerr) || jerr.Status != http.StatusUnauthorized {
+		t.Errorf("Stream: got error %v, want status 401", err)
+	}
+
+	// A failure to authorize the request is not retried.
+	calls = 0
+	errNoAuth := errors.New("no credentials")
+	cli = newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		t.Error("Unexpected request")
+	})
+	cli.Authorize = func(*http.Request) error {
+		atomic.AddInt32(&calls, 1)
+		return errNoAuth
+	}
+	cli.Reconnect = &jape.ReconnectPolicy{NetworkDelay: time.Millisecond}
+	err = cli.Stream(context.Background(), &jape.Request{Method: "stream"}, func([]byte) error {
+		t.Error("Unexpected callback")
+		return nil
+	})
+	if !errors.Is(err, errNoAuth) {
+		t.Errorf("Stream: got error %v, want %v", err, errNoAuth)
+	}
+	if calls != 1 {
+		t.Errorf("Authorize: got %d calls, want 1", calls)
+	}
+}
+
+func TestStallTimeout(t *testing.T) {
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("{\"n\":1}\r\n"))
+		for i := 0; i < 3; i++ {
+			w.Write([]byte("\r\n")) // keep-alive
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+		<-req.Context().Done() // stall until the client gives up
+	})
+	cli.StallTimeout = 100 * time.Millisecond
+
+	var nr int
+	start := time.Now()
+	err := cli.Stream(context.Background(), &jape.Request{Method: "stream"}, func([]byte) error {
+		nr++
+		return nil
+	})
+	if !errors.Is(err, jape.ErrStreamStalled) {
+		t.Errorf("Stream: got error %v, want %v", err, jape.ErrStreamStalled)
+	}
+	if nr != 1 {
+		t.Errorf("Stream: got %d messages, want 1", nr)
+	}
+
+	// The keep-alives should have extended the deadline.
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Errorf("Stream stalled after %v, expected keep-alives to extend it", elapsed)
+	}
+}
+
+func TestProblem(t *testing.T) {
+	tests := []struct {
+		ctype, body string
+		want        *jape.Problem
+	}{
+		{"application/problem+json",
+			`{"title":"Unauthorized","type":"about:blank","status":401,"detail":"Unauthorized"}`,
+			&jape.Problem{Title: "Unauthorized", Type: "about:blank", Status: 401, Detail: "Unauthorized"}},
+		{"application/json; charset=utf-8",
+			`{"errors":[{"code":187,"message":"Status is a duplicate."}]}`,
+			&jape.Problem{Errors: []*jape.ProblemError{{Code: 187, Message: "Status is a duplicate."}}}},
+		{"application/json",
+			`{"errors":[{"parameters":{"ids":["x"]},"message":"bad id"}],"title":"Invalid Request"}`,
+			&jape.Problem{Title: "Invalid Request", Errors: []*jape.ProblemError{{
+				Message: "bad id", Parameters: map[string][]string{"ids": {"x"}},
+			}}}},
+		{"text/html", `<html>Over capacity</html>`, nil},
+		{"application/json", `{"data":"not a problem"}`, nil},
+		{"application/json", `["x"]`, nil},
+	}
+	for _, test := range tests {
+		cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", test.ctype)
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(test.body))
+		})
+		_, _, err := cli.Call(context.Background(), &jape.Request{Method: "2/tweets"})
+		var e *jape.Error
+		if !errors.As(err, &e) {
+			t.Fatalf("Call: got error %v, want *jape.Error", err)
+		}
+		got, _ := json.Marshal(e.Problem)
+		want, _ := json.Marshal(test.want)
+		if !bytes.Equal(got, want) {
+			t.Errorf("Problem for %#q:\ngot  %s\nwant %s", test.body, got, want)
+		}
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.png")
+	if err := os.WriteFile(path, []byte("not really a PNG"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int32
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if req.URL.Query().Get("chunked") == "true" {
+			if req.ContentLength != -1 {
+				t.Errorf("Content-Length: got %d, want unknown", req.ContentLength)
+			}
+		} else if req.ContentLength <= 0 {
+			t.Errorf("Content-Length: got %d, want known size", req.ContentLength)
+		}
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("ParseMultipartForm: %v", err)
+			return
+		}
+		var parts []string
+		for name, vals := range req.MultipartForm.Value {
+			parts = append(parts, name+"="+strings.Join(vals, ","))
+		}
+		for name, fhs := range req.MultipartForm.File {
+			f, err := fhs[0].Open()
+			if err != nil {
+				t.Errorf("Open %q: %v", name, err)
+				continue
+			}
+			data, _ := io.ReadAll(f)
+			f.Close()
+			parts = append(parts, fmt.Sprintf("%s:%s=%s", name, fhs[0].Filename, data))
+		}
+		sort.Strings(parts)
+		fmt.Fprint(w, strings.Join(parts, " "))
+	})
+	cli.Retry = &jape.RetryPolicy{MinDelay: time.Millisecond}
+	ctx := context.Background()
+
+	t.Run("Retry", func(t *testing.T) {
+		var m jape.Multipart
+		m.AddField("media_category", "tweet_image")
+		if err := m.AddFile("media", path); err != nil {
+			t.Fatalf("AddFile: %v", err)
+		}
+		_, body, err := cli.Call(ctx, &jape.Request{
+			Method:     "upload",
+			HTTPMethod: "POST",
+			Multipart:  &m,
+			Retryable:  true,
+		})
+		if err != nil {
+			t.Fatalf("Call: unexpected error: %v", err)
+		}
+		const want = "media:image.png=not really a PNG media_category=tweet_image"
+		if got := string(body); got != want {
+			t.Errorf("Call: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Reader", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		var m jape.Multipart
+		m.AddReader("media", "data.bin", strings.NewReader("hello"), -1)
+		_, _, err := cli.Call(ctx, &jape.Request{
+			Method:     "upload",
+			HTTPMethod: "POST",
+			Params:     jape.Params{"chunked": {"true"}},
+			Multipart:  &m,
+			Retryable:  true,
+		})
+		var e *jape.Error
+		if !errors.As(err, &e) || e.Status != http.StatusServiceUnavailable {
+			t.Fatalf("Call: got error %v, want status 503 without retry", err)
+		}
+
+		atomic.StoreInt32(&calls, 1) // skip the failure
+		m = jape.Multipart{}
+		m.AddReader("media", "data.bin", strings.NewReader("hello"), -1)
+		_, body, err := cli.Call(ctx, &jape.Request{
+			Method:     "upload",
+			HTTPMethod: "POST",
+			Params:     jape.Params{"chunked": {"true"}},
+			Multipart:  &m,
+		})
+		if err != nil {
+			t.Fatalf("Call: unexpected error: %v", err)
+		}
+		if got, want := string(body), "media:data.bin=hello"; got != want {
+			t.Errorf("Call: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Boundary", func(t *testing.T) {
+		var m jape.Multipart
+		m.AddField("a", "b")
+		req := &jape.Request{Method: "upload", HTTPMethod: "POST", Multipart: &m}
+
+		// Concurrent uses of the body must agree on the boundary.
+		ctypes := make([]string, 8)
+		var wg sync.WaitGroup
+		for i := range ctypes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				body, _, ctype := req.Body()
+				body.(io.Closer).Close()
+				ctypes[i] = ctype
+			}(i)
+		}
+		wg.Wait()
+		for _, ct := range ctypes[1:] {
+			if ct != ctypes[0] {
+				t.Errorf("Content type: got %q, want %q", ct, ctypes[0])
+			}
+		}
+	})
+}
+
+func TestMaxBodySize(t *testing.T) {
+	const body = `{"data":"abcdefghijklmnopqrstuvwxyz"}`
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("length") == "true" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		} else {
+			w.(http.Flusher).Flush() // force chunked encoding
+		}
+		io.WriteString(w, body)
+		if req.URL.Query().Get("trailer") == "true" {
+			io.WriteString(w, `{}`)
+		}
+	})
+	ctx := context.Background()
+
+	checkTooLarge := func(t *testing.T, err error, size int64) {
+		t.Helper()
+		var e *jape.BodyTooLargeError
+		if !errors.As(err, &e) {
+			t.Fatalf("Got error %v, want %T", err, e)
+		}
+		if e.Limit != cli.MaxBodySize || e.Size != size {
+			t.Errorf("Got limit %d, size %d; want %d, %d", e.Limit, e.Size, cli.MaxBodySize, size)
+		}
+	}
+
+	cli.MaxBodySize = 10
+	t.Run("Call", func(t *testing.T) {
+		_, _, err := cli.Call(ctx, &jape.Request{Method: "x"})
+		checkTooLarge(t, err, -1)
+		_, _, err = cli.Call(ctx, &jape.Request{Method: "x", Params: jape.Params{"length": {"true"}}})
+		checkTooLarge(t, err, int64(len(body)))
+	})
+	t.Run("CallJSON", func(t *testing.T) {
+		var v struct{ Data string }
+		_, err := cli.CallJSON(ctx, &jape.Request{Method: "x"}, &v)
+		checkTooLarge(t, err, -1)
+	})
+
+	cli.MaxBodySize = int64(len(body))
+	t.Run("Limit", func(t *testing.T) {
+		var v struct{ Data string }
+		if _, err := cli.CallJSON(ctx, &jape.Request{Method: "x"}, &v); err != nil {
+			t.Fatalf("CallJSON: unexpected error: %v", err)
+		} else if v.Data != "abcdefghijklmnopqrstuvwxyz" {
+			t.Errorf("CallJSON: got %q, want alphabet", v.Data)
+		}
+		if _, data, err := cli.Call(ctx, &jape.Request{Method: "x"}); err != nil {
+			t.Fatalf("Call: unexpected error: %v", err)
+		} else if string(data) != body {
+			t.Errorf("Call: got %q, want %q", data, body)
+		}
+	})
+
+	cli.MaxBodySize = 0
+	t.Run("Trailer", func(t *testing.T) {
+		var v struct{ Data string }
+		_, err := cli.CallJSON(ctx, &jape.Request{Method: "x", Params: jape.Params{"trailer": {"true"}}}, &v)
+		if err == nil {
+			t.Error("CallJSON: got nil error for trailing data")
+		}
+	})
+}
+
+// A testPage mimics the structure of a large reply page, with raw fields that
+// are decoded later.
+type testPage struct {
+	Data     json.RawMessage            `json:"data"`
+	Includes map[string]json.RawMessage `json:"includes"`
+	Meta     json.RawMessage            `json:"meta"`
+}
+
+func newTestPage(n int) []byte {
+	type item struct {
+		ID   string `json:"id"`
+		Text string `json:"text"`
+	}
+	var tweets, users []item
+	for i := 0; i < n; i++ {
+		id := strconv.Itoa(1000000 + i)
+		tweets = append(tweets, item{ID: id, Text: strings.Repeat("lorem ipsum dolor sit amet ", 10)})
+		users = append(users, item{ID: id, Text: strings.Repeat("user description ", 10)})
+	}
+	data, err := json.Marshal(map[string]any{
+		"data":     tweets,
+		"includes": map[string]any{"users": users, "tweets": tweets},
+		"meta":     map[string]any{"result_count": n, "next_token": "xyzzy"},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func BenchmarkDecode(b *testing.B) {
+	page := newTestPage(1000)
+	cli := newTestServer(b, func(w http.ResponseWriter, req *http.Request) {
+		w.Write(page)
+	})
+	cli.Log = nil
+	ctx := context.Background()
+	req := &jape.Request{Method: "2/tweets/search/recent"}
+
+	b.Run("Buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(page)))
+		for i := 0; i < b.N; i++ {
+			_, body, err := cli.Call(ctx, req)
+			if err != nil {
+				b.Fatalf("Call: %v", err)
+			}
+			var v testPage
+			if err := json.Unmarshal(body, &v); err != nil {
+				b.Fatalf("Unmarshal: %v", err)
+			}
+		}
+	})
+	b.Run("Streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(page)))
+		for i := 0; i < b.N; i++ {
+			var v testPage
+			if _, err := cli.CallJSON(ctx, req, &v); err != nil {
+				b.Fatalf("CallJSON: %v", err)
+			}
+		}
+	})
+}
+
+func TestCallJSON(t *testing.T) {
+	page := newTestPage(10)
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("case") == "true" {
+			io.WriteString(w, `{"DATA":[1,2], "other": {"x":[3]}, "Meta": null}`)
+			return
+		}
+		w.Write(page)
+	})
+	ctx := context.Background()
+
+	var got, want testPage
+	if err := json.Unmarshal(page, &want); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if _, err := cli.CallJSON(ctx, &jape.Request{Method: "x"}, &got); err != nil {
+		t.Fatalf("CallJSON: unexpected error: %v", err)
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("CallJSON: result differs from json.Unmarshal:\ngot  %s\nwant %s", gotJSON, wantJSON)
+	}
+
+	var v testPage
+	if _, err := cli.CallJSON(ctx, &jape.Request{Method: "x", Params: jape.Params{"case": {"true"}}}, &v); err != nil {
+		t.Fatalf("CallJSON: unexpected error: %v", err)
+	}
+	if got := string(v.Data); got != "[1,2]" {
+		t.Errorf("CallJSON: got data %q, want [1,2]", got)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	const message = `{"text":"the quick brown fox jumps over the lazy dog"}`
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Accept-Encoding: got %q, want gzip", req.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		defer zw.Close()
+		if req.URL.Path != "/stream" {
+			io.WriteString(zw, strings.Repeat(message, 100))
+			return
+		}
+		for i := 0; i < 3; i++ {
+			io.WriteString(zw, message+"\r\n")
+			for j := 0; j < 3; j++ {
+				io.WriteString(zw, "\r\n") // keep-alive
+				zw.Flush()
+				w.(http.Flusher).Flush()
+				time.Sleep(20 * time.Millisecond)
+			}
+		}
+	})
+	var logged []string
+	cli.Log = func(tag jape.LogTag, msg string) {
+		if tag == jape.LogStreamBody {
+			logged = append(logged, msg)
+		}
+	}
+	cli.LogMask = jape.LogStreamBody
+	cli.Compress = true
+	cli.Counters = new(jape.TransferCounters)
+	cli.StallTimeout = 50 * time.Millisecond
+	ctx := context.Background()
+
+	t.Run("Call", func(t *testing.T) {
+		_, body, err := cli.Call(ctx, &jape.Request{Method: "call"})
+		if err != nil {
+			t.Fatalf("Call: unexpected error: %v", err)
+		}
+		if got, want := string(body), strings.Repeat(message, 100); got != want {
+			t.Errorf("Call: got %d bytes, want %d", len(got), len(want))
+		}
+		rcv, dec := cli.Counters.Received.Load(), cli.Counters.Decoded.Load()
+		if dec != int64(len(body)) || rcv >= dec {
+			t.Errorf("Counters: received %d, decoded %d; want decoded %d > received", rcv, dec, len(body))
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		var nr int
+		err := cli.Stream(ctx, &jape.Request{Method: "stream"}, func(msg []byte) error {
+			if string(msg) != message {
+				t.Errorf("Stream: got message %q, want %q", msg, message)
+			}
+			nr++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Stream: unexpected error: %v", err)
+		}
+		if nr != 3 {
+			t.Errorf("Stream: got %d messages, want 3", nr)
+		}
+		if len(logged) != 3 {
+			t.Errorf("Logged %d stream messages, want 3", len(logged))
+		}
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/2/users/"):
+			w.Header().Set("x-rate-limit-remaining", "299")
+			io.WriteString(w, `{"data":{}}`)
+		case req.URL.Path == "/2/tweets/search/stream":
+			io.WriteString(w, "{\"a\":1}\r\n{\"b\":2}\r\n")
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	})
+	cli.Metrics = new(jape.Metrics)
+	ctx := context.Background()
+
+	for _, id := range []string{"12", "34"} {
+		if _, _, err := cli.Call(ctx, &jape.Request{Method: "2/users/" + id}); err != nil {
+			t.Fatalf("Call: unexpected error: %v", err)
+		}
+	}
+	cli.Call(ctx, &jape.Request{Method: "2/bogus", HTTPMethod: "POST", Data: []byte(`{"x":1}`)})
+	if err := cli.Stream(ctx, &jape.Request{Method: "2/tweets/search/stream"}, func([]byte) error {
+		return nil
+	}); err != nil {
+		t.Fatalf("Stream: unexpected error: %v", err)
+	}
+
+	srv := httptest.NewServer(cli.Metrics)
+	defer srv.Close()
+	rsp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get metrics: %v", err)
+	}
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if ct := rsp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type: got %q, want Prometheus text format", ct)
+	}
+	text := string(body)
+	t.Logf("Metrics:\n%s", text)
+
+	for _, want := range []string{
+		`jape_requests_total{method="GET",endpoint="2/users/:id",code="2xx"} 2`,
+		`jape_requests_total{method="POST",endpoint="2/bogus",code="4xx"} 1`,
+		`jape_request_duration_seconds_count{method="GET",endpoint="2/users/:id"} 2`,
+		`jape_request_duration_seconds_bucket{method="GET",endpoint="2/users/:id",le="+Inf"} 2`,
+		`jape_request_bytes_total{method="POST",endpoint="2/bogus"} 7`,
+		`jape_response_bytes_total{method="GET",endpoint="2/users/:id"} 22`,
+		`jape_stream_messages_total{method="GET",endpoint="2/tweets/search/stream"} 2`,
+		`jape_rate_limit_remaining{method="GET",endpoint="2/users/:id"} 299`,
+		"# TYPE jape_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(text, want+"\n") {
+			t.Errorf("Metrics output is missing %q", want)
+		}
+	}
+}
+
+// testTracer is a Tracer that records the spans it creates.
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (tr *testTracer) Start(ctx context.Context, name string) (context.Context, jape.Span) {
+	span := &testSpan{name: name, attrs: make(map[string]string)}
+	span.tc.TraceID[0] = 1
+	span.tc.SpanID[0] = byte(len(tr.spans) + 1)
+	tr.spans = append(tr.spans, span)
+	return ctx, span
+}
+
+type testSpan struct {
+	name  string
+	attrs map[string]string
+	tc    jape.TraceContext
+	ended bool
+	err   error
+}
+
+func (s *testSpan) SetAttributes(attrs ...slog.Attr) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value.String()
+	}
+}
+
+func (s *testSpan) TraceContext() jape.TraceContext { return s.tc }
+func (s *testSpan) End(err error)                   { s.ended = true; s.err = err }
+
+func TestTracer(t *testing.T) {
+	var calls int32
+	var parents []string
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		parents = append(parents, req.Header.Get("traceparent"))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "{\"a\":1}\r\n{\"b\":2}\r\n")
+	})
+	cli.Retry = &jape.RetryPolicy{MinDelay: time.Millisecond}
+	tr := new(testTracer)
+	cli.Tracer = tr
+	ctx := context.Background()
+
+	if _, _, err := cli.Call(ctx, &jape.Request{
+		Method: "2/users/12/followers",
+		Params: jape.Params{"pagination_token": {"xyzzy"}},
+	}); err != nil {
+		t.Fatalf("Call: unexpected error: %v", err)
+	}
+	if err := cli.Stream(ctx, &jape.Request{Method: "2/tweets/sample/stream"}, func([]byte) error {
+		return nil
+	}); err != nil {
+		t.Fatalf("Stream: unexpected error: %v", err)
+	}
+
+	if len(tr.spans) != 2 {
+		t.Fatalf("Got %d spans, want 2", len(tr.spans))
+	}
+	checkSpan := func(span *testSpan, name string, want map[string]string) {
+		t.Helper()
+		if span.name != name || !span.ended || span.err != nil {
+			t.Errorf("Span %q: ended=%v err=%v, want %q ended without error", span.name, span.ended, span.err, name)
+		}
+		for key, val := range want {
+			if got := span.attrs[key]; got != val {
+				t.Errorf("Span %q attribute %q: got %q, want %q", span.name, key, got, val)
+			}
+		}
+	}
+	checkSpan(tr.spans[0], "jape.Call", map[string]string{
+		"endpoint":   "GET 2/users/:id/followers",
+		"page_token": "xyzzy",
+		"attempt":    "2",
+		"status":     "200",
+	})
+	checkSpan(tr.spans[1], "jape.Stream", map[string]string{
+		"endpoint": "GET 2/tweets/sample/stream",
+		"attempt":  "1",
+		"messages": "2",
+	})
+
+	want := []string{
+		tr.spans[0].tc.String(), tr.spans[0].tc.String(), // Call, with retry
+		tr.spans[1].tc.String(), // Stream
+	}
+	if strings.Join(parents, " ") != strings.Join(want, " ") {
+		t.Errorf("traceparent headers: got %q, want %q", parents, want)
+	}
+}
+
+func TestTraceParent(t *testing.T) {
+	const input = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tc, err := jape.ParseTraceParent(input)
+	if err != nil {
+		t.Fatalf("ParseTraceParent(%q): unexpected error: %v", input, err)
+	}
+	if got := tc.String(); got != input {
+		t.Errorf("String: got %q, want %q", got, input)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if tc, err := jape.ParseTraceParent(bad); err == nil {
+			t.Errorf("ParseTraceParent(%q): got %v, want error", bad, tc)
+		}
+	}
+
+	// Without a tracer, requests carry a child of the context trace.
+	var got string
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		got = req.Header.Get("traceparent")
+		io.WriteString(w, "{}")
+	})
+	ctx := jape.ContextWithTrace(context.Background(), tc)
+	if _, _, err := cli.Call(ctx, &jape.Request{Method: "x"}); err != nil {
+		t.Fatalf("Call: unexpected error: %v", err)
+	}
+	child, err := jape.ParseTraceParent(got)
+	if err != nil {
+		t.Fatalf("Invalid traceparent %q: %v", got, err)
+	}
+	if child.TraceID != tc.TraceID || child.SpanID == tc.SpanID || child.Flags != tc.Flags {
+		t.Errorf("traceparent: got %v, want a child of %v", child, tc)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var calls, total int32
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		fmt.Fprintf(w, `{"path":%q,"n":%d}`, req.URL.Path, atomic.AddInt32(&total, 1))
+	})
+	cli.Cache = &jape.Cache{
+		TTLs: map[string]time.Duration{
+			"GET 2/users/:id": time.Hour,
+			"GET 2/lists/:id": 50 * time.Millisecond,
+		},
+		MaxEntries: 3,
+	}
+	ctx := context.Background()
+
+	call := func(ctx context.Context, req *jape.Request) string {
+		t.Helper()
+		_, body, err := cli.Call(ctx, req)
+		if err != nil {
+			t.Fatalf("Call %q: unexpected error: %v", req.Method, err)
+		}
+		return string(body)
+	}
+	user := func(id string, fields ...string) *jape.Request {
+		req := &jape.Request{Method: "2/users/" + id, Params: make(jape.Params)}
+		req.Params.Add("user.fields", fields...)
+		return req
+	}
+	checkCalls := func(want int32) {
+		t.Helper()
+		if got := atomic.SwapInt32(&calls, 0); got != want {
+			t.Errorf("Server saw %d calls, want %d", got, want)
+		}
+	}
+
+	// Repeated requests are answered from the cache.
+	first := call(ctx, user("1"))
+	if got := call(ctx, user("1")); got != first {
+		t.Errorf("Cached reply: got %q, want %q", got, first)
+	}
+	var v struct{ N int }
+	if _, err := cli.CallJSON(ctx, user("1"), &v); err != nil {
+		t.Fatalf("CallJSON: unexpected error: %v", err)
+	}
+	checkCalls(1)
+
+	// Requests with different parameters are cached separately.
+	call(ctx, user("1", "created_at"))
+	call(ctx, user("1", "created_at"))
+	call(ctx, user("2"))
+	checkCalls(2)
+
+	// Bypass skips the lookup, but refreshes the entry.
+	if got := call(jape.BypassCache(ctx), user("1")); got == first {
+		t.Errorf("Bypass: got cached reply %q", got)
+	}
+	refreshed := call(ctx, user("1"))
+	if refreshed == first {
+		t.Errorf("Bypass did not refresh the cache")
+	}
+	checkCalls(1)
+
+	// Invalidation removes entries.
+	cli.Cache.Invalidate(user("1"))
+	call(ctx, user("1"))
+	checkCalls(1)
+	cli.Cache.InvalidateEndpoint("GET 2/users/:id")
+	if n := cli.Cache.Len(); n != 0 {
+		t.Errorf("After InvalidateEndpoint: cache has %d entries, want 0", n)
+	}
+
+	// Old entries are evicted to make room.
+	for _, id := range []string{"1", "2", "3", "4", "1"} {
+		call(ctx, user(id))
+	}
+	checkCalls(5)
+	if n := cli.Cache.Len(); n != 3 {
+		t.Errorf("Cache has %d entries, want 3", n)
+	}
+
+	// Entries expire.
+	call(ctx, &jape.Request{Method: "2/lists/5"})
+	call(ctx, &jape.Request{Method: "2/lists/5"})
+	checkCalls(1)
+	time.Sleep(60 * time.Millisecond)
+	call(ctx, &jape.Request{Method: "2/lists/5"})
+	checkCalls(1)
+
+	// Uncached endpoints and methods go to the server.
+	call(ctx, &jape.Request{Method: "2/tweets/6"})
+	call(ctx, &jape.Request{Method: "2/tweets/6"})
+	call(ctx, &jape.Request{Method: "2/users/7", HTTPMethod: "DELETE"})
+	call(ctx, &jape.Request{Method: "2/users/7", HTTPMethod: "DELETE"})
+	checkCalls(4)
+}
+
+func TestCoalescer(t *testing.T) {
+	var calls int32
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(w, `{"n":%d}`, n)
+	})
+	cli.Log = nil
+	cli.Coalescer = new(jape.Coalescer)
+	ctx := context.Background()
+
+	const numCallers = 5
+	results := make(chan string, numCallers)
+	for i := 0; i < numCallers; i++ {
+		go func() {
+			_, body, err := cli.Call(ctx, &jape.Request{Method: "2/users/1"})
+			if err != nil {
+				t.Errorf("Call: unexpected error: %v", err)
+			}
+			results <- string(body)
+		}()
+	}
+	for i := 0; i < numCallers; i++ {
+		if got := <-results; got != `{"n":1}` {
+			t.Errorf("Call: got %q, want %q", got, `{"n":1}`)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Server saw %d calls, want 1", n)
+	}
+
+	// If the leader gives up, a waiting caller tries again.
+	atomic.StoreInt32(&calls, 0)
+	lctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	go cli.Call(lctx, &jape.Request{Method: "2/users/2"})
+	time.Sleep(5 * time.Millisecond)
+	_, body, err := cli.Call(ctx, &jape.Request{Method: "2/users/2"})
+	if err != nil {
+		t.Fatalf("Call: unexpected error: %v", err)
+	}
+	if got := string(body); got != `{"n":2}` {
+		t.Errorf("Call: got %q, want %q", got, `{"n":2}`)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	var cur, peak int32
+	release := make(chan struct{})
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&cur, 1)
+		defer atomic.AddInt32(&cur, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+				break
+			}
+		}
+		if req.URL.Path == "/stream" {
+			w.(http.Flusher).Flush()
+			<-release
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, "{}")
+	})
+	cli.Log = nil
+	cli.Concurrency = &jape.ConcurrencyLimit{
+		Max:       3,
+		Endpoints: map[string]int{"GET stream": 1},
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, _, err := cli.Call(ctx, &jape.Request{Method: "2/users/" + strconv.Itoa(i)}); err != nil {
+				t.Errorf("Call: unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if p := atomic.LoadInt32(&peak); p > 3 {
+		t.Errorf("Peak concurrency %d, want at most 3", p)
+	}
+
+	// A stream holds its slot until it ends, so a second stream must wait,
+	// and gives up when its context ends.
+	done := make(chan error, 1)
+	go func() {
+		done <- cli.Stream(ctx, &jape.Request{Method: "stream"}, func([]byte) error { return nil })
+	}()
+	time.Sleep(20 * time.Millisecond)
+	tctx, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	err := cli.Stream(tctx, &jape.Request{Method: "stream"}, func([]byte) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stream: got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Stream: unexpected error: %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("Unexpected request in dry run: %s %s", req.Method, req.URL)
+	})
+	cli.DryRun = true
+	cli.Authorize = jape.BearerTokenAuthorizer("secret-token")
+	cli.Interceptors = []jape.Interceptor{jape.SetHeader("X-Test", "ok")}
+	cli.Retry = &jape.RetryPolicy{MaxAttempts: 3}
+	ctx := context.Background()
+
+	t.Run("Call", func(t *testing.T) {
+		_, _, err := cli.Call(ctx, &jape.Request{
+			Method:     "2/users/12/blocking",
+			HTTPMethod: "POST",
+			Params:     jape.Params{"x": {"it's"}},
+			Data:       []byte(`{"target_user_id":"13","access_token":"secret-body"}`),
+		})
+		ex := jape.Explain(err)
+		if ex == nil {
+			t.Fatalf("Call: got error %v, want explanation", err)
+		}
+		t.Logf("Explanation:\n%s", ex.Describe())
+		if ex.Method != "POST" {
+			t.Errorf("Method: got %q, want POST", ex.Method)
+		}
+		if want := cli.BaseURL + "/2/users/12/blocking?x=it%27s"; ex.URL != want {
+			t.Errorf("URL: got %q, want %q", ex.URL, want)
+		}
+		for name, want := range map[string]string{
+			"Authorization": "Bearer " + jape.Redacted,
+			"Content-Type":  "application/json",
+			"X-Test":        "ok",
+		} {
+			if got := ex.Header.Get(name); got != want {
+				t.Errorf("Header %q: got %q, want %q", name, got, want)
+			}
+		}
+		if got, want := string(ex.Body), `{"target_user_id":"13","access_token":"`+jape.Redacted+`"}`; got != want {
+			t.Errorf("Body: got %#q, want %#q", got, want)
+		}
+		curl := ex.Curl()
+		for _, want := range []string{
+			"curl -X POST '" + cli.BaseURL + "/2/users/12/blocking?x=it%27s'",
+			"-H 'Authorization: Bearer [REDACTED]'",
+			"-H 'X-Test: ok'",
+			`--data-raw '{"target_user_id":"13","access_token":"[REDACTED]"}'`,
+		} {
+			if !strings.Contains(curl, want) {
+				t.Errorf("Curl: missing %q in %q", want, curl)
+			}
+		}
+		if strings.Contains(ex.Describe(), "secret") {
+			t.Errorf("Explanation contains a secret:\n%s", ex.Describe())
+		}
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		var m jape.Multipart
+		m.AddField("media_category", "tweet_image")
+		m.AddReader("media", "cat.png", strings.NewReader("meow"), 4)
+		_, err := cli.CallJSON(ctx, &jape.Request{
+			Method:     "1.1/media/upload.json",
+			HTTPMethod: "POST",
+			Multipart:  &m,
+		}, new(any))
+		ex := jape.Explain(err)
+		if ex == nil {
+			t.Fatalf("CallJSON: got error %v, want explanation", err)
+		}
+		curl := ex.Curl()
+		for _, want := range []string{
+			"--form-string media_category=tweet_image",
+			"-F 'media=@-;filename=cat.png'",
+		} {
+			if !strings.Contains(curl, want) {
+				t.Errorf("Curl: missing %q in %q", want, curl)
+			}
+		}
+		if strings.Contains(curl, "Content-Type") {
+			t.Errorf("Curl: unexpected multipart content type in %q", curl)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		err := cli.Stream(ctx, &jape.Request{Method: "2/tweets/sample/stream"}, func([]byte) error {
+			t.Error("Unexpected stream message")
+			return nil
+		})
+		if ex := jape.Explain(err); ex == nil {
+			t.Errorf("Stream: got error %v, want explanation", err)
+		} else if ex.Method != "GET" {
+			t.Errorf("Method: got %q, want GET", ex.Method)
+		}
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		if req.URL.Path == "/2/tweets/search/recent" && !healthy.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{}"))
+	})
+	var logBuf bytes.Buffer
+	cli.Logger = slog.New(slog.NewTextHandler(&logBuf, nil))
+	cli.Breaker = &jape.CircuitBreaker{Failures: 2, Cooldown: 50 * time.Millisecond}
+	ctx := context.Background()
+
+	const endpoint = "GET 2/tweets/search/recent"
+	search := &jape.Request{Method: "2/tweets/search/recent"}
+	other := &jape.Request{Method: "2/users/12"}
+	call := func(req *jape.Request) error {
+		_, _, err := cli.Call(ctx, req)
+		return err
+	}
+	checkState := func(want jape.CircuitState) {
+		t.Helper()
+		if got := cli.Breaker.State(endpoint); got != want {
+			t.Errorf("State: got %v, want %v", got, want)
+		}
+	}
+
+	// Consecutive failures open the circuit.
+	for i := 0; i < 2; i++ {
+		if err := call(search); err == nil || errors.Is(err, jape.ErrCircuitOpen) {
+			t.Errorf("Call %d: got %v, want server error", i+1, err)
+		}
+	}
+	checkState(jape.CircuitOpen)
+
+	// While open, requests to the endpoint are rejected without being sent,
+	// but other endpoints are unaffected.
+	calls.Store(0)
+	err := call(search)
+	var coe *jape.CircuitOpenError
+	if !errors.Is(err, jape.ErrCircuitOpen) || !errors.As(err, &coe) {
+		t.Errorf("Call while open: got %v, want %v", err, jape.ErrCircuitOpen)
+	} else if coe.Endpoint != endpoint {
+		t.Errorf("Rejected endpoint: got %q, want %q", coe.Endpoint, endpoint)
+	}
+	if err := call(other); err != nil {
+		t.Errorf("Call other endpoint: unexpected error: %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Server calls while open: got %d, want 1", n)
+	}
+
+	// After the cooldown, a failed trial reopens the circuit.
+	time.Sleep(60 * time.Millisecond)
+	checkState(jape.CircuitHalfOpen)
+	if err := call(search); err == nil || errors.Is(err, jape.ErrCircuitOpen) {
+		t.Errorf("Failed trial: got %v, want server error", err)
+	}
+	checkState(jape.CircuitOpen)
+
+	// After the cooldown, a successful trial closes the circuit.
+	time.Sleep(60 * time.Millisecond)
+	healthy.Store(true)
+	if err := call(search); err != nil {
+		t.Errorf("Successful trial: unexpected error: %v", err)
+	}
+	checkState(jape.CircuitClosed)
+
+	log := logBuf.String()
+	t.Logf("Log:\n%s", log)
+	for _, want := range []string{
+		"to=open", "from=open to=half-open", "from=half-open to=open", "from=half-open to=closed",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("Log does not contain %q", want)
+		}
+	}
+}
+
+// blockLimiter is a Limiter that holds requests for which block reports true
+// until their context ends.
+type blockLimiter struct{ block func(*jape.Request) bool }
+
+func (b blockLimiter) Admit(ctx context.Context, req *jape.Request) error {
+	if b.block(req) {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (blockLimiter) Update(*jape.Request, http.Header) {}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	var healthy atomic.Bool
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		if !healthy.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("{}"))
+	})
+	cli.Breaker = &jape.CircuitBreaker{Failures: 1, Cooldown: 20 * time.Millisecond}
+	cli.Limiter = blockLimiter{block: func(req *jape.Request) bool {
+		return req.Params["held"] != nil
+	}}
+	ctx := context.Background()
+
+	const endpoint = "GET 2/tweets/search/recent"
+	if _, _, err := cli.Call(ctx, &jape.Request{Method: "2/tweets/search/recent"}); err == nil {
+		t.Fatal("Call: got nil, want server error")
+	}
+	time.Sleep(30 * time.Millisecond)
+	healthy.Store(true)
+
+	// A request held by the limiter after the cooldown must not take the trial
+	// from a request that is ready to be sent.
+	hctx, cancel := context.WithCancel(ctx)
+	held := make(chan error, 1)
+	go func() {
+		_, _, err := cli.Call(hctx, &jape.Request{
+			Method: "2/tweets/search/recent",
+			Params: jape.Params{"held": []string{"true"}},
+		})
+		held <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, _, err := cli.Call(ctx, &jape.Request{Method: "2/tweets/search/recent"}); err != nil {
+		t.Errorf("Trial call: unexpected error: %v", err)
+	}
+	if got := cli.Breaker.State(endpoint); got != jape.CircuitClosed {
+		t.Errorf("State: got %v, want %v", got, jape.CircuitClosed)
+	}
+	cancel()
+	if err := <-held; !errors.Is(err, context.Canceled) {
+		t.Errorf("Held call: got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestScope(t *testing.T) {
+	cli := newTestServer(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	})
+	type scopeKey struct{}
+	var calls int
+	cli.Scope = func(ctx context.Context, run func(context.Context) error) error {
+		calls++
+		if err := run(context.WithValue(ctx, scopeKey{}, true)); err != nil {
+			return &jape.Error{Message: "scoped", Err: err}
+		}
+		return nil
+	}
+	var inScope bool
+	cli.Interceptors = []jape.Interceptor{func(hreq *http.Request, next jape.Handler) (*http.Response, error) {
+		inScope = hreq.Context().Value(scopeKey{}) != nil
+		return next(hreq)
+	}}
+	ctx := context.Background()
+	req := &jape.Request{Method: "2/tweets/search/recent"}
+
+	if _, _, err := cli.Call(ctx, req); err != nil {
+		t.Errorf("Call: unexpected error: %v", err)
+	}
+	var v struct{ OK bool }
+	if _, err := cli.CallJSON(ctx, req, &v); err != nil || !v.OK {
+		t.Errorf("CallJSON: got %+v, %v; want ok", v, err)
+	}
+	if calls != 2 || !inScope {
+		t.Errorf("Scope: got %d calls (in scope %v), want 2 in scope", calls, inScope)
+	}
+
+	// The scope may replace the error of the call.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err := cli.Stream(cctx, req, func([]byte) error { return nil })
+	if e, ok := err.(*jape.Error); !ok || e.Message != "scoped" || !errors.Is(err, context.Canceled) {
+		t.Errorf("Stream: got %v, want scoped cancellation", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// A Coalescer merges identical GET requests that are in flight at the same
+// time, so that only one of them is sent to the server and all the callers
+// share its response. Requests are identical if they have the same method
+// path and parameters. To use a Coalescer, set it as the Coalescer of a
+// client.
+//
+// Only Call and CallJSON requests are coalesced; streams and requests with
+// other HTTP methods are not. The response to a coalesced request is read
+// completely before it is delivered to the callers.
+//
+// If the request sent on behalf of a group of callers fails because its
+// caller's context ended, the remaining callers whose contexts are still
+// active try again rather than sharing the failure.
+//
+// A zero Coalescer is ready for use. A Coalescer is safe for concurrent use
+// by multiple goroutines, but should not be shared by clients with different
+// credentials or base URLs.
+type Coalescer struct {
+	μ       sync.Mutex
+	flights map[string]*flight
+}
+
+// A flight is a request in progress on behalf of one or more callers.
+type flight struct {
+	done chan struct{} // closed when the response is available
+
+	// These fields are set before done is closed.
+	rsp  *http.Response
+	body []byte
+	err  error
+}
+
+// response returns a copy of the response for f, with its own body reader.
+func (f *flight) response() *http.Response {
+	cp := *f.rsp
+	cp.Header = f.rsp.Header.Clone()
+	cp.Body = io.NopCloser(bytes.NewReader(f.body))
+	cp.ContentLength = int64(len(f.body))
+	return &cp
+}
+
+// join returns the flight for key, and reports whether the caller is the
+// leader responsible for completing it.
+func (g *Coalescer) join(key string) (*flight, bool) {
+	g.μ.Lock()
+	defer g.μ.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f, false
+	}
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+func (g *Coalescer) finish(key string, f *flight) {
+	g.μ.Lock()
+	defer g.μ.Unlock()
+	delete(g.flights, key)
+	close(f.done)
+}
+
+// startShared is as start, but if c has a coalescer and req may be
+// coalesced, it shares the response with other identical requests in flight.
+func (c *Client) startShared(ctx context.Context, req *Request) (*http.Response, error) {
+	if c.Coalescer == nil || !req.isCacheable() {
+		return c.start(ctx, req)
+	}
+	key := req.cacheKey()
+	for {
+		f, leader := c.Coalescer.join(key)
+		if leader {
+			f.rsp, f.body, f.err = c.startBuffered(ctx, req)
+			c.Coalescer.finish(key, f)
+		} else {
+			select {
+			case <-ctx.Done():
+				return nil, &Error{Message: "waiting for shared request", Err: ctx.Err()}
+			case <-f.done:
+			}
+			setSpanAttrs(ctx, slog.Bool("coalesced", true))
+
+			// If the leader gave up, try again on our own behalf.
+			if isContextError(f.err) && ctx.Err() == nil {
+				continue
+			}
+		}
+		if f.err != nil {
+			return nil, f.err
+		}
+		return f.response(), nil
+	}
+}
+
+// startBuffered calls start and reads the complete response body.
+func (c *Client) startBuffered(ctx context.Context, req *Request) (*http.Response, []byte, error) {
+	rsp, err := c.start(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rsp.Body.Close()
+	if err := c.checkSize(rsp); err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll(c.limitBody(rsp.Body))
+	if err != nil {
+		return nil, nil, &Error{Status: rsp.StatusCode, Message: "reading response body", Err: err}
+	}
+	return rsp, body, nil
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// TransferCounters accumulate the number of bytes transferred by a Client.
+// The counters may be read at any time, including while requests are in
+// progress.
+type TransferCounters struct {
+	Sent     atomic.Int64 // request body bytes sent
+	Received atomic.Int64 // response body bytes received, as sent on the wire
+	Decoded  atomic.Int64 // response body bytes received, after decompression
+}
+
+// A transferStats records the decoded size of a single response body, so that
+// the logging interceptor can report it alongside the size on the wire.
+type transferStats struct {
+	compressed atomic.Bool
+	decoded    atomic.Int64
+}
+
+type transferContextKey struct{}
+
+func transferFromContext(ctx context.Context) *transferStats {
+	x, _ := ctx.Value(transferContextKey{}).(*transferStats)
+	return x
+}
+
+// transfer is the built-in interceptor that negotiates compression (if
+// c.Compress is set) and updates c.Counters (if set). When a response is
+// compressed, transfer replaces its body with one that decompresses the data
+// incrementally as they are read, so that the rest of the client (and any
+// interceptors that precede this one) see only the uncompressed data.
+func (c *Client) transfer(hreq *http.Request, next Handler) (*http.Response, error) {
+	if c.Compress {
+		// Setting this header explicitly disables the transparent
+		// decompression in http.Transport, so we see the data on the wire.
+		hreq.Header.Set("Accept-Encoding", "gzip")
+	}
+	var x *transferStats
+	if c.Logger != nil {
+		x = new(transferStats)
+		hreq = hreq.WithContext(context.WithValue(hreq.Context(), transferContextKey{}, x))
+	}
+	if cs := c.Counters; cs != nil && hreq.ContentLength > 0 {
+		cs.Sent.Add(hreq.ContentLength)
+	}
+	rsp, err := next(hreq)
+	if err != nil {
+		return nil, err
+	}
+
+	var wire io.ReadCloser = rsp.Body
+	if cs := c.Counters; cs != nil {
+		wire = countReader{ReadCloser: wire, n: &cs.Received}
+	}
+	if c.Compress && strings.EqualFold(rsp.Header.Get("Content-Encoding"), "gzip") {
+		rsp.Body = &gzipBody{wire: wire}
+		rsp.Header.Del("Content-Encoding")
+		rsp.Header.Del("Content-Length")
+		rsp.ContentLength = -1
+		rsp.Uncompressed = true
+		if x != nil {
+			x.compressed.Store(true)
+			rsp.Body = countReader{ReadCloser: rsp.Body, n: &x.decoded}
+		}
+	} else {
+		rsp.Body = wire
+	}
+	if cs := c.Counters; cs != nil {
+		rsp.Body = countReader{ReadCloser: rsp.Body, n: &cs.Decoded}
+	}
+	return rsp, nil
+}
+
+// countReader wraps a response body to add the number of bytes read from it
+// to a counter.
+type countReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (c countReader) Read(data []byte) (int, error) {
+	nr, err := c.ReadCloser.Read(data)
+	c.n.Add(int64(nr))
+	return nr, err
+}
+
+// A gzipBody decompresses a gzip-encoded response body. The gzip reader is
+// created by the first Read, since constructing it blocks until the header of
+// the compressed data arrives, which for a stream may take a while.
+type gzipBody struct {
+	wire io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (g *gzipBody) Read(data []byte) (int, error) {
+	if g.zr == nil && g.err == nil {
+		g.zr, g.err = gzip.NewReader(g.wire)
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	return g.zr.Read(data)
+}
+
+func (g *gzipBody) Close() error { return g.wire.Close() }
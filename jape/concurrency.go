@@ -0,0 +1,121 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// A ConcurrencyLimit caps the number of requests a client has in progress at
+// once, both in total and for each endpoint. To use a ConcurrencyLimit, set
+// it as the Concurrency of a client.
+//
+// A request occupies a slot from when it is sent until its response body has
+// been read and closed; for a stream, this is the lifetime of the connection.
+// A request that cannot get a slot waits until one is available or until its
+// context ends.  Responses answered from a Cache or shared by a Coalescer do
+// not occupy a slot.
+//
+// A ConcurrencyLimit is safe for concurrent use by multiple goroutines, and
+// may be shared by multiple clients that share a concurrency budget. Its
+// settings must not be changed once it is in use.
+type ConcurrencyLimit struct {
+	// The maximum number of requests in progress at once. If zero, the total
+	// is not limited.
+	Max int
+
+	// The maximum number of requests in progress at once for each endpoint,
+	// keyed by the endpoint string of the request (see the Endpoint method of
+	// Request). For endpoints not listed here, use PerEndpoint.
+	Endpoints map[string]int
+
+	// The maximum number of requests in progress at once for any endpoint not
+	// listed in Endpoints. If zero, such endpoints are not limited.
+	PerEndpoint int
+
+	μ         sync.Mutex
+	total     chan struct{}
+	endpoints map[string]chan struct{}
+}
+
+// semaphores returns the semaphores governing the specified endpoint. Either
+// or both may be nil, indicating no limit.
+func (c *ConcurrencyLimit) semaphores(endpoint string) (ep, total chan struct{}) {
+	c.μ.Lock()
+	defer c.μ.Unlock()
+	if c.total == nil && c.Max > 0 {
+		c.total = make(chan struct{}, c.Max)
+	}
+	n, ok := c.Endpoints[endpoint]
+	if !ok {
+		n = c.PerEndpoint
+	}
+	if n > 0 {
+		ep, ok = c.endpoints[endpoint]
+		if !ok {
+			if c.endpoints == nil {
+				c.endpoints = make(map[string]chan struct{})
+			}
+			ep = make(chan struct{}, n)
+			c.endpoints[endpoint] = ep
+		}
+	}
+	return ep, c.total
+}
+
+// acquire waits for a slot for a request to endpoint, and returns a function
+// that releases the slot. It reports an error if ctx ends first.
+func (c *ConcurrencyLimit) acquire(ctx context.Context, endpoint string) (func(), error) {
+	if c == nil {
+		return func() {}, nil
+	}
+	// Acquire the semaphores in a consistent order, to avoid deadlock.
+	ep, total := c.semaphores(endpoint)
+	if err := acquireSem(ctx, ep); err != nil {
+		return nil, err
+	}
+	if err := acquireSem(ctx, total); err != nil {
+		releaseSem(ep)
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			releaseSem(total)
+			releaseSem(ep)
+		})
+	}, nil
+}
+
+func acquireSem(ctx context.Context, sem chan struct{}) error {
+	if sem == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case sem <- struct{}{}:
+		return nil
+	}
+}
+
+func releaseSem(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
+
+// releaseBody wraps a response body to release a concurrency slot when the
+// body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
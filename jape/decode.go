@@ -0,0 +1,120 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// decodeJSON decodes a single JSON value from dec into v.
+//
+// A json.Decoder buffers a complete value before decoding it, so decoding a
+// large reply object in one step holds the whole body in memory alongside
+// the result.  When v points to a struct and the value is an object, the
+// fields of the object are instead decoded one at a time into the
+// corresponding fields of the struct, so that only one field value at a time
+// is buffered.  Otherwise, decodeJSON is equivalent to dec.Decode(v).
+//
+// This does not avoid buffering a large field. In particular, the data of a
+// twitter.Reply is decoded as json.RawMessage and decoded again by the caller.
+// For a search page of 1000 tweets (see BenchmarkDecode), this reduces bytes
+// allocated per call by about a third compared to buffering the body, with a
+// few more allocations and no change in time.
+func decodeJSON(dec *json.Decoder, v any) error {
+	fields, ok := structFields(v)
+	if !ok {
+		return dec.Decode(v)
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	} else if tok == nil {
+		return nil // null leaves v unmodified, as in json.Unmarshal
+	} else if tok != json.Delim('{') {
+		return &json.UnmarshalTypeError{Value: "non-object", Type: reflect.TypeOf(v).Elem()}
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		target, ok := fields.lookup(key)
+		if !ok {
+			target = new(json.RawMessage) // skip an unknown field
+		}
+		if err := dec.Decode(target); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token() // consume the closing brace
+	return err
+}
+
+// fieldMap maps the JSON names of the fields of a struct to pointers to the
+// corresponding fields.
+type fieldMap map[string]any
+
+// lookup finds the field for key, preferring an exact match but accepting a
+// case-insensitive match as encoding/json does.
+func (m fieldMap) lookup(key string) (any, bool) {
+	if f, ok := m[key]; ok {
+		return f, true
+	}
+	for name, f := range m {
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// structFields reports whether v is a non-nil pointer to a struct that can be
+// decoded field by field, and if so returns a map of its fields. Structs with
+// custom unmarshaling methods or embedded fields are decoded as a unit.
+func structFields(v any) (fieldMap, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, false
+	} else if rv.Type().Implements(jsonUnmarshalerType) || rv.Type().Implements(textUnmarshalerType) {
+		return nil, false
+	}
+	sv := rv.Elem()
+	st := sv.Type()
+	m := make(fieldMap)
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.Anonymous {
+			return nil, false
+		} else if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if tag == "-" {
+			continue
+		} else if strings.Contains(opts, "string") {
+			return nil, false
+		} else if name == "" {
+			name = f.Name
+		}
+		if _, dup := m[name]; dup {
+			return nil, false
+		}
+		m[name] = sv.Field(i).Addr().Interface()
+	}
+	return m, true
+}
+
+// errTrailingData is reported when a response body contains data after the
+// JSON value it should contain.
+var errTrailingData = errors.New("unexpected data after response")
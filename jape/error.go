@@ -2,12 +2,23 @@
 
 package jape
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+)
+
 // Error is the concrete type of errors returned by a Call.
 type Error struct {
 	Message string // a description of the error
 	Status  int    // an HTTP status code, if known
 	Err     error  // the underlying error, if any
 	Data    []byte // the response data from the server, if any
+
+	// If the server reported a structured description of the failure, this
+	// is its decoded form; otherwise nil.
+	Problem *Problem
 }
 
 // Error satisfies the error interface.
@@ -20,3 +31,75 @@ func (e *Error) Error() string {
 
 // Unwrap satisfies the wrapping interface for the errors package.
 func (e *Error) Unwrap() error { return e.Err }
+
+// BodyTooLargeError is the underlying error reported when a response body
+// exceeds the MaxBodySize of a Client.
+type BodyTooLargeError struct {
+	Limit int64 // the maximum permitted size in bytes
+	Size  int64 // the declared size of the body, or -1 if unknown
+}
+
+// Error satisfies the error interface.
+func (e *BodyTooLargeError) Error() string {
+	if e.Size < 0 {
+		return fmt.Sprintf("response body exceeds %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("response body is %d bytes, exceeding %d", e.Size, e.Limit)
+}
+
+// A Problem is the decoded form of an error response from the server.  It
+// supports both the "problem details" format of RFC 7807, which is used by the
+// Twitter API v2, and the legacy {"errors":[...]} format used by the Twitter
+// API v1.1. Fields not reported by the server are empty.
+//
+// See https://datatracker.ietf.org/doc/html/rfc7807
+type Problem struct {
+	Type   string          `json:"type,omitempty"`   // a URI identifying the problem type
+	Title  string          `json:"title,omitempty"`  // a short summary of the problem type
+	Detail string          `json:"detail,omitempty"` // an explanation of this occurrence
+	Status int             `json:"status,omitempty"` // the HTTP status code
+	Reason string          `json:"reason,omitempty"` // e.g., "client-not-enrolled"
+	Errors []*ProblemError `json:"errors,omitempty"` // individual errors, if any
+}
+
+// A ProblemError describes an individual error reported in a Problem.
+type ProblemError struct {
+	Code    int    `json:"code,omitempty"`    // legacy (v1.1) error code
+	Message string `json:"message,omitempty"` // a human-readable description
+
+	// For an invalid request, the parameters that were rejected.
+	Parameters map[string][]string `json:"parameters,omitempty"`
+}
+
+// HasCode reports whether p contains an individual error with the given
+// legacy error code. It is safe to call HasCode on a nil *Problem.
+func (p *Problem) HasCode(code int) bool {
+	if p != nil {
+		for _, e := range p.Errors {
+			if e.Code == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeProblem decodes data as a problem description, if its content type
+// indicates JSON and it has the expected structure. Otherwise it returns nil.
+func decodeProblem(ctype string, data []byte) *Problem {
+	if mt, _, err := mime.ParseMediaType(ctype); err != nil {
+		return nil
+	} else if mt != "application/problem+json" && mt != "application/json" {
+		return nil
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil
+	}
+	var p Problem
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil
+	} else if p.Type == "" && p.Title == "" && p.Detail == "" && len(p.Errors) == 0 {
+		return nil
+	}
+	return &p
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// An Explanation describes an HTTP request that a Client would send to the
+// API. A client with DryRun set reports an Explanation instead of sending each
+// request. Secrets in the URL, headers, and body are redacted unless the
+// client has LogSecrets set.
+//
+// An Explanation implements the error interface, so that a dry run can be
+// carried through code that invokes a request and expects an error. Use
+// Explain to recover the Explanation from such an error.
+type Explanation struct {
+	Method string      // the HTTP method, e.g., "POST"
+	URL    string      // the complete request URL
+	Header http.Header // the request headers, including authorization
+
+	// The request body, or nil if the request has no body. A multipart body
+	// is not rendered; see Form.
+	Body []byte
+
+	// For a multipart request, the curl arguments that send its parts, as
+	// pairs of option and value, e.g., "-F", "media=@cat.png".
+	Form []string
+}
+
+// Error implements the error interface.
+func (e *Explanation) Error() string { return "dry run: " + e.Method + " " + e.URL }
+
+// Describe renders e as a multi-line description of the request, comprising
+// the method and URL, the headers, the body, and an equivalent curl command.
+func (e *Explanation) Describe() string {
+	var sb strings.Builder
+	sb.WriteString(e.Method + " " + e.URL + "\n")
+	for _, name := range sortedKeys(e.Header) {
+		for _, v := range e.Header[name] {
+			sb.WriteString(name + ": " + v + "\n")
+		}
+	}
+	if len(e.Body) != 0 {
+		sb.WriteString("\n")
+		sb.Write(e.Body)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n" + e.Curl() + "\n")
+	return sb.String()
+}
+
+// Curl renders e as an equivalent curl command line. If the request is
+// redacted, the command must be edited to restore the secrets before use.
+func (e *Explanation) Curl() string {
+	args := []string{"curl", "-X", e.Method, shellQuote(e.URL)}
+	for _, name := range sortedKeys(e.Header) {
+		if len(e.Form) != 0 && name == "Content-Type" {
+			continue // curl generates its own multipart boundary
+		}
+		for _, v := range e.Header[name] {
+			args = append(args, "-H", shellQuote(name+": "+v))
+		}
+	}
+	for i := 0; i+1 < len(e.Form); i += 2 {
+		args = append(args, e.Form[i], shellQuote(e.Form[i+1]))
+	}
+	if len(e.Body) != 0 {
+		args = append(args, "--data-raw", shellQuote(string(e.Body)))
+	}
+	return strings.Join(args, " ")
+}
+
+// Explain reports whether err is or wraps an *Explanation, as reported by a
+// client with DryRun set. If so, it returns the Explanation; otherwise nil.
+func Explain(err error) *Explanation {
+	var e *Explanation
+	if errors.As(err, &e) {
+		return e
+	}
+	return nil
+}
+
+// explain constructs the HTTP request for req and returns an error wrapping
+// an Explanation of it. The request passes through the client's interceptors
+// and authorization, but not its rate limiter, cache, or other policies.
+func (c *Client) explain(ctx context.Context, req *Request) error {
+	hreq, err := c.newHTTPRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+	if hreq.Body != nil {
+		defer hreq.Body.Close()
+	}
+	if c.Compress {
+		hreq.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	chain := c.Interceptors
+	if c.Authorize != nil {
+		chain = append(chain[:len(chain):len(chain)], c.authorize)
+	}
+	h := func(hreq *http.Request) (*http.Response, error) {
+		ex := &Explanation{
+			Method: hreq.Method,
+			URL:    c.redact(RedactURL, hreq.URL.String()),
+			Header: hreq.Header.Clone(),
+		}
+		if auth := ex.Header.Values("Authorization"); len(auth) != 0 {
+			for i, v := range auth {
+				auth[i] = c.redact(RedactAuthorization, v)
+			}
+		}
+		if req.Multipart != nil {
+			for _, p := range req.Multipart.parts {
+				ex.Form = append(ex.Form, p.curl...)
+			}
+		} else if hreq.Body != nil {
+			data, err := io.ReadAll(hreq.Body)
+			if err != nil {
+				return nil, &Error{Message: "reading request body", Err: err}
+			}
+			ex.Body = []byte(c.redactBody(data))
+		}
+		return nil, &Error{Message: "dry run", Err: ex}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		ic, next := chain[i], h
+		h = func(hreq *http.Request) (*http.Response, error) { return ic(hreq, next) }
+	}
+	rsp, err := h(hreq)
+	if err == nil {
+		// An interceptor answered the request without calling through.
+		rsp.Body.Close()
+		return &Error{Message: "dry run: request was not explained"}
+	} else if _, ok := err.(*Error); !ok {
+		return &Error{Message: "interceptor", Err: err}
+	}
+	return err
+}
+
+func sortedKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
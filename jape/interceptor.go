@@ -0,0 +1,96 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"context"
+	"net/http"
+)
+
+// A Handler sends an HTTP request to the API and returns its response.
+type Handler func(*http.Request) (*http.Response, error)
+
+// An Interceptor wraps the exchange of a single HTTP request and response with
+// the API. It receives the outbound request and the next handler in the
+// chain. An interceptor may modify or replace the request before passing it
+// to next, and may inspect or replace the response returned by next. An
+// interceptor may also return a response or an error without calling next at
+// all.
+//
+// If an interceptor replaces the response body, the replacement must deliver
+// the same data as the original (or the data the interceptor wishes the
+// client to see), and closing it must close the original.
+//
+// Interceptors are used for both Call and Stream requests. For a Stream, the
+// response body is read incrementally after the interceptor returns.
+//
+// The jape.Request from which an HTTP request was constructed can be
+// recovered by calling RequestFromContext on the context of the HTTP request.
+type Interceptor func(hreq *http.Request, next Handler) (*http.Response, error)
+
+type requestContextKey struct{}
+
+// RequestFromContext returns the *Request associated with ctx, or nil if ctx
+// is not the context of an HTTP request issued by a Client.
+func RequestFromContext(ctx context.Context) *Request {
+	if req, ok := ctx.Value(requestContextKey{}).(*Request); ok {
+		return req
+	}
+	return nil
+}
+
+// SetHeader returns an Interceptor that sets the specified header to the given
+// value on each outbound request.
+func SetHeader(name, value string) Interceptor {
+	return func(hreq *http.Request, next Handler) (*http.Response, error) {
+		hreq.Header.Set(name, value)
+		return next(hreq)
+	}
+}
+
+// send sends hreq to the API through the client's interceptor chain.
+//
+// The chain consists of the interceptors in c.Interceptors, in order, followed
+// by the built-in interceptors for compression and byte counting (if
+// c.Compress or c.Counters is set), authorization (if c.Authorize is set),
+// logging (if c.Log or c.Logger is set), and metrics (if c.Metrics is set).
+// The innermost handler issues the request using the client's HTTP client.
+func (c *Client) send(hreq *http.Request) (*http.Response, error) {
+	chain := c.Interceptors
+	if c.Compress || c.Counters != nil {
+		chain = append(chain[:len(chain):len(chain)], c.transfer)
+	}
+	if c.Authorize != nil {
+		chain = append(chain[:len(chain):len(chain)], c.authorize)
+	}
+	if c.Log != nil || c.Logger != nil {
+		chain = append(chain[:len(chain):len(chain)], c.logExchange)
+	}
+	if c.Metrics != nil {
+		chain = append(chain[:len(chain):len(chain)], c.measure)
+	}
+
+	h := c.do
+	for i := len(chain) - 1; i >= 0; i-- {
+		ic, next := chain[i], h
+		h = func(hreq *http.Request) (*http.Response, error) { return ic(hreq, next) }
+	}
+	return h(hreq)
+}
+
+// do issues hreq using the client's HTTP client.
+func (c *Client) do(hreq *http.Request) (*http.Response, error) {
+	rsp, err := c.httpClient().Do(hreq)
+	if err != nil {
+		return nil, &Error{Message: "issuing request", Err: transportError{err}}
+	}
+	return rsp, nil
+}
+
+// authorize is the built-in interceptor that calls c.Authorize.
+func (c *Client) authorize(hreq *http.Request, next Handler) (*http.Response, error) {
+	if err := c.Authorize(hreq); err != nil {
+		return nil, &Error{Message: "attaching authorization", Err: err}
+	}
+	return next(hreq)
+}
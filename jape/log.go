@@ -0,0 +1,98 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// logExchange is the built-in interceptor that logs the request URL,
+// authorization, and response status. If c.Logger is set, it also writes a
+// structured record for the exchange once the response body is closed.
+func (c *Client) logExchange(hreq *http.Request, next Handler) (*http.Response, error) {
+	if c.wantLog(LogRequestURL) {
+		c.log(LogRequestURL, c.redact(RedactURL, hreq.URL.String()))
+	}
+	if c.Authorize != nil && c.wantLog(LogAuthorization) {
+		c.log(LogAuthorization, c.redact(RedactAuthorization, hreq.Header.Get("authorization")))
+	}
+	start := time.Now()
+	rsp, err := next(hreq)
+	if err != nil {
+		c.logRecord(hreq, nil, start, 0, err)
+		return nil, err
+	}
+	c.log(LogHTTPStatus, rsp.Status)
+	if c.Logger != nil {
+		rsp.Body = &countingBody{ReadCloser: rsp.Body, onClose: func(nr int64) {
+			c.logRecord(hreq, rsp, start, nr, nil)
+		}}
+	}
+	return rsp, nil
+}
+
+// logRecord writes a structured log record for an exchange to c.Logger.
+// If the exchange failed, rsp == nil and err != nil.
+func (c *Client) logRecord(hreq *http.Request, rsp *http.Response, start time.Time, nr int64, err error) {
+	if c.Logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", hreq.Method),
+		slog.String("path", hreq.URL.Path),
+	}
+	if req := RequestFromContext(hreq.Context()); req != nil {
+		attrs = append(attrs, slog.String("endpoint", req.Endpoint()))
+	}
+	attrs = append(attrs,
+		slog.Duration("latency", time.Since(start)),
+		slog.Int64("bytes_sent", max(hreq.ContentLength, 0)),
+	)
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		c.Logger.LogAttrs(hreq.Context(), slog.LevelError, "request failed", attrs...)
+		return
+	}
+	attrs = append(attrs,
+		slog.Int("status", rsp.StatusCode),
+		slog.Int64("bytes_received", nr),
+	)
+	if x := transferFromContext(hreq.Context()); x != nil && x.compressed.Load() {
+		attrs = append(attrs, slog.Int64("bytes_decoded", x.decoded.Load()))
+	}
+	if v, err := strconv.Atoi(rsp.Header.Get("x-rate-limit-remaining")); err == nil {
+		attrs = append(attrs, slog.Int("rate_limit_remaining", v))
+	}
+	level := slog.LevelDebug
+	if rsp.StatusCode >= 400 {
+		level = slog.LevelWarn
+	}
+	c.Logger.LogAttrs(hreq.Context(), level, "request", attrs...)
+}
+
+// countingBody wraps a response body to count the bytes read from it, and
+// calls onClose with the total when the body is first closed.
+type countingBody struct {
+	io.ReadCloser
+	nr      int64
+	once    sync.Once
+	onClose func(nr int64)
+}
+
+func (b *countingBody) Read(data []byte) (int, error) {
+	nr, err := b.ReadCloser.Read(data)
+	atomic.AddInt64(&b.nr, int64(nr))
+	return nr, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.onClose(atomic.LoadInt64(&b.nr)) })
+	return err
+}
@@ -0,0 +1,234 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the buckets of
+// the request latency histogram kept by a Metrics value.
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics records request metrics for a Client, keyed by endpoint (see the
+// Endpoint method of Request), so that requests for different IDs are counted
+// together. To record metrics, set a Metrics as the Metrics field of a client.
+//
+// For each endpoint, a Metrics tracks:
+//
+//   - The number of requests, by HTTP status class ("2xx", "4xx", etc.), or
+//     "error" if the request failed without a response.
+//   - A histogram of the latency to receive response headers.
+//   - The number of request and response body bytes on the wire.
+//   - The number of messages received from streams.
+//   - The most recent rate limit remaining reported by the server.
+//
+// A Metrics implements http.Handler, serving the current values in the
+// Prometheus text exposition format.
+//
+// A zero Metrics is ready for use. A Metrics is safe for concurrent use by
+// multiple goroutines, and may be shared by multiple clients.
+type Metrics struct {
+	// If non-empty, the upper bounds of the latency histogram buckets in
+	// seconds, in increasing order. If empty, use DefaultLatencyBuckets.
+	// This must not be modified once the Metrics is in use.
+	Buckets []float64
+
+	μ         sync.Mutex
+	endpoints map[string]*endpointMetrics
+}
+
+type endpointMetrics struct {
+	μ          sync.Mutex
+	requests   map[string]int64 // status class → count
+	buckets    []int64          // cumulative counts per bucket
+	latencyN   int64
+	latencySum float64
+	rateLimit  int64 // -1 if unknown
+
+	sent, received, messages atomic.Int64
+}
+
+func (m *Metrics) buckets() []float64 {
+	if len(m.Buckets) == 0 {
+		return DefaultLatencyBuckets
+	}
+	return m.Buckets
+}
+
+// endpoint returns the metrics for the specified endpoint, creating them if
+// necessary.
+func (m *Metrics) endpoint(name string) *endpointMetrics {
+	m.μ.Lock()
+	defer m.μ.Unlock()
+	em, ok := m.endpoints[name]
+	if !ok {
+		if m.endpoints == nil {
+			m.endpoints = make(map[string]*endpointMetrics)
+		}
+		em = &endpointMetrics{
+			requests:  make(map[string]int64),
+			buckets:   make([]int64, len(m.buckets())),
+			rateLimit: -1,
+		}
+		m.endpoints[name] = em
+	}
+	return em
+}
+
+// observe records the completion of a request to the API.  If rsp == nil,
+// the request failed without a response.
+func (m *Metrics) observe(em *endpointMetrics, rsp *http.Response, latency time.Duration) {
+	class := "error"
+	if rsp != nil {
+		class = strconv.Itoa(rsp.StatusCode/100) + "xx"
+	}
+	secs := latency.Seconds()
+
+	em.μ.Lock()
+	defer em.μ.Unlock()
+	em.requests[class]++
+	if rsp != nil {
+		for i, ub := range m.buckets() {
+			if secs <= ub {
+				em.buckets[i]++
+			}
+		}
+		em.latencyN++
+		em.latencySum += secs
+		if v, err := strconv.ParseInt(rsp.Header.Get("x-rate-limit-remaining"), 10, 64); err == nil {
+			em.rateLimit = v
+		}
+	}
+}
+
+// measure is the built-in interceptor that records metrics for each exchange.
+func (c *Client) measure(hreq *http.Request, next Handler) (*http.Response, error) {
+	req := RequestFromContext(hreq.Context())
+	if req == nil {
+		return next(hreq)
+	}
+	em := c.Metrics.endpoint(req.Endpoint())
+	if hreq.ContentLength > 0 {
+		em.sent.Add(hreq.ContentLength)
+	}
+	start := time.Now()
+	rsp, err := next(hreq)
+	if err != nil {
+		c.Metrics.observe(em, nil, time.Since(start))
+		return nil, err
+	}
+	c.Metrics.observe(em, rsp, time.Since(start))
+	rsp.Body = countReader{ReadCloser: rsp.Body, n: &em.received}
+	return rsp, nil
+}
+
+// streamMessage records the receipt of a stream message for req.
+func (m *Metrics) streamMessage(req *Request) {
+	if m != nil {
+		m.endpoint(req.Endpoint()).messages.Add(1)
+	}
+}
+
+// ServeHTTP implements the http.Handler interface. It serves the current
+// metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteText(w)
+}
+
+// WriteText writes the current metrics to w in the Prometheus text exposition
+// format. Each metric is labelled with the HTTP method and the path template
+// of its endpoint.
+func (m *Metrics) WriteText(w io.Writer) error {
+	type entry struct {
+		method, path string
+		em           *endpointMetrics
+	}
+	m.μ.Lock()
+	entries := make([]entry, 0, len(m.endpoints))
+	for name, em := range m.endpoints {
+		method, path, _ := strings.Cut(name, " ")
+		entries = append(entries, entry{method, path, em})
+	}
+	m.μ.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].path == entries[j].path {
+			return entries[i].method < entries[j].method
+		}
+		return entries[i].path < entries[j].path
+	})
+	labels := func(e entry) string {
+		return fmt.Sprintf(`method="%s",endpoint="%s"`, escapeLabel(e.method), escapeLabel(e.path))
+	}
+
+	buf := bufio.NewWriter(w)
+	header := func(name, typ, help string) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+
+	header("jape_requests_total", "counter", "Requests issued, by HTTP status class.")
+	for _, e := range entries {
+		e.em.μ.Lock()
+		classes := make([]string, 0, len(e.em.requests))
+		for class := range e.em.requests {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Fprintf(buf, "jape_requests_total{%s,code=\"%s\"} %d\n", labels(e), class, e.em.requests[class])
+		}
+		e.em.μ.Unlock()
+	}
+
+	header("jape_request_duration_seconds", "histogram", "Latency to receive response headers.")
+	for _, e := range entries {
+		e.em.μ.Lock()
+		for i, ub := range m.buckets() {
+			fmt.Fprintf(buf, "jape_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels(e), strconv.FormatFloat(ub, 'g', -1, 64), e.em.buckets[i])
+		}
+		fmt.Fprintf(buf, "jape_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels(e), e.em.latencyN)
+		fmt.Fprintf(buf, "jape_request_duration_seconds_sum{%s} %s\n", labels(e), strconv.FormatFloat(e.em.latencySum, 'g', -1, 64))
+		fmt.Fprintf(buf, "jape_request_duration_seconds_count{%s} %d\n", labels(e), e.em.latencyN)
+		e.em.μ.Unlock()
+	}
+
+	header("jape_request_bytes_total", "counter", "Request body bytes sent.")
+	for _, e := range entries {
+		fmt.Fprintf(buf, "jape_request_bytes_total{%s} %d\n", labels(e), e.em.sent.Load())
+	}
+	header("jape_response_bytes_total", "counter", "Response body bytes received.")
+	for _, e := range entries {
+		fmt.Fprintf(buf, "jape_response_bytes_total{%s} %d\n", labels(e), e.em.received.Load())
+	}
+	header("jape_stream_messages_total", "counter", "Messages received from streams.")
+	for _, e := range entries {
+		if n := e.em.messages.Load(); n > 0 {
+			fmt.Fprintf(buf, "jape_stream_messages_total{%s} %d\n", labels(e), n)
+		}
+	}
+	header("jape_rate_limit_remaining", "gauge", "Requests remaining in the current rate limit window.")
+	for _, e := range entries {
+		e.em.μ.Lock()
+		v := e.em.rateLimit
+		e.em.μ.Unlock()
+		if v >= 0 {
+			fmt.Fprintf(buf, "jape_rate_limit_remaining{%s} %d\n", labels(e), v)
+		}
+	}
+	return buf.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,225 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A Multipart is a builder for a multipart/form-data request body. To send a
+// multipart body, populate a Multipart and assign it to the Multipart field of
+// a Request:
+//
+//	var m jape.Multipart
+//	m.AddField("media_category", "tweet_image")
+//	m.AddFile("media", "/path/to/image.png")
+//	req := &jape.Request{
+//	   Method:     "1.1/media/upload.json",
+//	   HTTPMethod: "POST",
+//	   Multipart:  &m,
+//	}
+//
+// The contents of file parts are streamed to the server as the request is
+// sent, and are not buffered in memory. Files are opened each time the body
+// is sent, so a request whose parts are all fields or files may be retried.
+//
+// Multipart parameters are not included in an OAuth 1.0 signature, as
+// required by RFC 5849 Section 3.4.1.3.1.
+//
+// A zero Multipart is ready for use, and has no parts. A Multipart must not be
+// modified while a request that uses it is in progress.
+type Multipart struct {
+	bound    sync.Once
+	boundary string
+	parts    []*formPart
+}
+
+// A formPart is a single part of a multipart body.
+type formPart struct {
+	header  textproto.MIMEHeader
+	size    int64                         // -1 if unknown
+	open    func() (io.ReadCloser, error) // deliver the contents of the part
+	oneShot bool                          // whether open can be called only once
+	curl    []string                      // equivalent curl arguments
+}
+
+// AddField adds a form field with the given name and value.
+func (m *Multipart) AddField(name, value string) {
+	p := m.addPart(formHeader(name, ""), int64(len(value)), func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(value)), nil
+	})
+	p.curl = []string{"--form-string", name + "=" + value}
+}
+
+// AddFile adds a file part with the given field name, whose contents are read
+// from the file at path. The file is opened when the request is sent, and its
+// base name is reported as the filename of the part.
+func (m *Multipart) AddFile(name, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	} else if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a regular file", path)
+	}
+	p := m.addPart(formHeader(name, fi.Name()), fi.Size(), func() (io.ReadCloser, error) {
+		return os.Open(path)
+	})
+	p.curl = []string{"-F", name + "=@" + path}
+	return nil
+}
+
+// AddReader adds a file part with the given field name and filename, whose
+// contents are read from r. If size >= 0, it must be the exact number of bytes
+// r will deliver; otherwise the size is treated as unknown and the request is
+// sent with chunked encoding.
+//
+// The contents of r are consumed when the request is sent, so a request with
+// a reader part is not retried. If r implements io.Closer, it is closed after
+// its contents have been sent.
+func (m *Multipart) AddReader(name, filename string, r io.Reader, size int64) {
+	var used atomic.Bool
+	p := m.addPart(formHeader(name, filename), size, func() (io.ReadCloser, error) {
+		if used.Swap(true) {
+			return nil, fmt.Errorf("contents of part %q already consumed", name)
+		} else if rc, ok := r.(io.ReadCloser); ok {
+			return rc, nil
+		}
+		return io.NopCloser(r), nil
+	})
+	p.oneShot = true
+	p.curl = []string{"-F", name + "=@-;filename=" + filename}
+}
+
+func (m *Multipart) addPart(h textproto.MIMEHeader, size int64, open func() (io.ReadCloser, error)) *formPart {
+	if size < 0 {
+		size = -1
+	}
+	p := &formPart{header: h, size: size, open: open}
+	m.parts = append(m.parts, p)
+	return p
+}
+
+// formHeader returns the MIME header for a form part with the given field name
+// and optional filename.
+func formHeader(name, filename string) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	if filename == "" {
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(name)))
+	} else {
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(name), escapeQuotes(filename)))
+		h.Set("Content-Type", "application/octet-stream")
+	}
+	return h
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string { return quoteEscaper.Replace(s) }
+
+// canRetry reports whether the body can be sent more than once.
+func (m *Multipart) canRetry() bool {
+	for _, p := range m.parts {
+		if p.oneShot {
+			return false
+		}
+	}
+	return true
+}
+
+// getBoundary returns the boundary string for m, choosing one the first time
+// it is called. It is safe to call concurrently, as for retries.
+func (m *Multipart) getBoundary() string {
+	m.bound.Do(func() {
+		m.boundary = multipart.NewWriter(io.Discard).Boundary()
+	})
+	return m.boundary
+}
+
+// contentType returns the content-type of the body, including its boundary.
+func (m *Multipart) contentType() string {
+	return "multipart/form-data; boundary=" + m.getBoundary()
+}
+
+// size returns the total encoded size of the body, or -1 if the size of any
+// part is unknown.
+func (m *Multipart) size() int64 {
+	var cw countWriter
+	w := multipart.NewWriter(&cw)
+	w.SetBoundary(m.getBoundary())
+	var total int64
+	for _, p := range m.parts {
+		if p.size < 0 {
+			return -1
+		}
+		w.CreatePart(p.header)
+		total += p.size
+	}
+	w.Close()
+	return total + cw.n
+}
+
+type countWriter struct{ n int64 }
+
+func (c *countWriter) Write(data []byte) (int, error) {
+	c.n += int64(len(data))
+	return len(data), nil
+}
+
+// reader returns a reader that delivers the encoded body. The contents of the
+// parts are not opened until the first call to Read.
+func (m *Multipart) reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	return &multipartReader{m: m, pr: pr, pw: pw}
+}
+
+// A multipartReader streams a multipart body by encoding its parts into a
+// pipe from a separate goroutine. The goroutine is started by the first Read,
+// so that an unsent body does not leak it.
+type multipartReader struct {
+	m     *Multipart
+	start sync.Once
+	pr    *io.PipeReader
+	pw    *io.PipeWriter
+}
+
+func (r *multipartReader) Read(data []byte) (int, error) {
+	r.start.Do(func() {
+		go func() { r.pw.CloseWithError(r.m.writeTo(r.pw)) }()
+	})
+	return r.pr.Read(data)
+}
+
+func (r *multipartReader) Close() error {
+	r.start.Do(func() {}) // do not start the writer after Close
+	return r.pr.Close()
+}
+
+// writeTo encodes the parts of m to w.
+func (m *Multipart) writeTo(w io.Writer) error {
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary(m.getBoundary())
+	for _, p := range m.parts {
+		pw, err := mw.CreatePart(p.header)
+		if err != nil {
+			return err
+		}
+		rc, err := p.open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(pw, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
@@ -0,0 +1,246 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Default initial delays for a ReconnectPolicy, following the reconnection
+// guidelines published for the Twitter streaming APIs.
+const (
+	DefaultNetworkDelay   = 250 * time.Millisecond // linear, up to 16s
+	DefaultHTTPDelay      = 5 * time.Second        // exponential, up to 320s
+	DefaultRateLimitDelay = 1 * time.Minute        // exponential, up to 16m
+)
+
+// Maximum delays for each class of reconnect backoff, as multiples of the
+// initial delay.
+const (
+	maxNetworkSteps   = 64 // 250ms × 64 = 16s
+	maxHTTPShift      = 6  // 5s × 2^6 = 320s
+	maxRateLimitShift = 4  // 1m × 2^4 = 16m
+)
+
+// A ReconnectPolicy controls how a Client re-establishes a stream that fails
+// or is disconnected. The delay between attempts depends on the failure:
+//
+//   - Transport errors (see ErrTransport), stalls (see Client.StallTimeout),
+//     and disconnection of an established stream back off linearly from
+//     NetworkDelay, up to 64 times that delay.
+//
+//   - HTTP errors back off exponentially from HTTPDelay, up to 64 times that
+//     delay.
+//
+//   - HTTP 420 and 429 (rate limit) errors back off exponentially from
+//     RateLimitDelay, up to 16 times that delay.
+//
+// Other errors are not retried. These include other 4xx client errors, and
+// errors that occur before the request is sent, such as a failure to attach
+// authorization or a request rejected by the client's Limiter or Breaker.
+// The counter of failed attempts is reset each time a stream is established.
+type ReconnectPolicy struct {
+	// The maximum number of consecutive failed attempts to make before giving
+	// up and reporting the last error. If zero, there is no limit.
+	MaxAttempts int
+
+	// Initial backoff delays for each kind of failure. If zero, use the
+	// corresponding default (DefaultNetworkDelay, etc.).
+	NetworkDelay   time.Duration
+	HTTPDelay      time.Duration
+	RateLimitDelay time.Duration
+
+	// If set, this function is called synchronously for each change in the
+	// state of a stream connection.
+	OnEvent func(StreamEvent)
+}
+
+// A StreamEvent reports a change in the state of a stream connection.
+type StreamEvent struct {
+	Type    StreamEventType
+	Request *Request      // the stream request
+	Attempt int           // the number of consecutive failed attempts
+	Delay   time.Duration // for StreamRetrying, the delay before the attempt
+	Err     error         // for StreamDisconnected and StreamRetrying, the cause
+}
+
+// StreamEventType identifies the kind of a StreamEvent.
+type StreamEventType int
+
+// Constants for StreamEventType.
+const (
+	StreamConnected    StreamEventType = iota + 1 // the stream was established
+	StreamDisconnected                            // the stream ended or failed
+	StreamRetrying                                // the client is waiting to reconnect
+)
+
+var eventNames = map[StreamEventType]string{
+	StreamConnected:    "Connected",
+	StreamDisconnected: "Disconnected",
+	StreamRetrying:     "Retrying",
+}
+
+func (t StreamEventType) String() string {
+	if s, ok := eventNames[t]; ok {
+		return s
+	}
+	return "Event" + strconv.Itoa(int(t))
+}
+
+func (p *ReconnectPolicy) event(e StreamEvent) {
+	if p.OnEvent != nil {
+		p.OnEvent(e)
+	}
+}
+
+// reconnectDelay reports whether the stream should be reconnected after the
+// specified number of consecutive failed attempts, the last of which failed
+// with err, and if so how long to wait before doing so. If disconnected is
+// true, the stream was established before it failed.
+func (p *ReconnectPolicy) reconnectDelay(attempt int, err error, disconnected bool) (time.Duration, bool) {
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return 0, false
+	} else if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+	var e *Error
+	status := 0
+	if errors.As(err, &e) {
+		status = e.Status
+	}
+	switch {
+	case status == 0:
+		if !disconnected && !IsTransient(err) && !errors.Is(err, ErrStreamStalled) {
+			return 0, false // a local failure will not be fixed by retrying
+		}
+		return pick(p.NetworkDelay, DefaultNetworkDelay) * time.Duration(min(attempt, maxNetworkSteps)), true
+	case status == 420 || status == http.StatusTooManyRequests:
+		return pick(p.RateLimitDelay, DefaultRateLimitDelay) << min(attempt-1, maxRateLimitShift), true
+	case status >= 500:
+		return pick(p.HTTPDelay, DefaultHTTPDelay) << min(attempt-1, maxHTTPShift), true
+	}
+	return 0, false // other client errors will not be fixed by retrying
+}
+
+func pick(d, dflt time.Duration) time.Duration {
+	if d <= 0 {
+		return dflt
+	}
+	return d
+}
+
+// reconnectStream implements Stream for a client with a reconnect policy.
+func (c *Client) reconnectStream(ctx context.Context, req *Request, f Callback) error {
+	p := c.Reconnect
+
+	// Record whether the stream ended because of the callback, to distinguish
+	// this from a disconnection.
+	var cbErr error
+	g := func(msg []byte) error {
+		cbErr = f(msg)
+		return cbErr
+	}
+
+	for attempt := 1; ; attempt++ {
+		disconnected := false
+		hrsp, err := c.start(ctx, req)
+		if err == nil {
+			hrsp, err = c.checkStream(hrsp)
+		}
+		if err == nil {
+			attempt = 1
+			p.event(StreamEvent{Type: StreamConnected, Request: req})
+
+			err = c.stream(ctx, req, hrsp, g)
+			if cbErr != nil {
+				return streamResult(err)
+			} else if ctx.Err() != nil {
+				return &Error{Message: "stream ended", Err: ctx.Err()}
+			} else if err == nil {
+				err = &Error{Message: "stream closed by server"}
+			}
+			p.event(StreamEvent{Type: StreamDisconnected, Request: req, Err: err})
+			disconnected = true
+		}
+
+		delay, ok := p.reconnectDelay(attempt, err, disconnected)
+		if !ok {
+			return err
+		}
+		p.event(StreamEvent{Type: StreamRetrying, Request: req, Attempt: attempt, Delay: delay, Err: err})
+		if c.wantLog(LogRetry) {
+			c.log(LogRetry, fmt.Sprintf("stream attempt %d failed (%v); reconnecting in %v", attempt, err, delay))
+		}
+		if c.Logger != nil {
+			c.Logger.LogAttrs(ctx, slog.LevelWarn, "reconnecting stream",
+				slog.String("endpoint", req.Endpoint()),
+				slog.Int("attempt", attempt),
+				slog.Duration("delay", delay),
+				slog.Any("error", err),
+			)
+		}
+		if serr := sleep(ctx, delay); serr != nil {
+			return &Error{Message: "waiting to reconnect", Err: serr}
+		}
+		setSpanAttrs(ctx, slog.Int("attempt", attempt+1))
+	}
+}
+
+// A watchdog calls a function if a reader does not deliver data within a
+// timeout. A nil *watchdog is valid and does nothing.
+type watchdog struct {
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// newWatchdog returns a watchdog that calls fire if no data are read within
+// the given timeout. If timeout <= 0, newWatchdog returns nil.
+func newWatchdog(timeout time.Duration, fire func()) *watchdog {
+	if timeout <= 0 {
+		return nil
+	}
+	return &watchdog{timeout: timeout, timer: time.AfterFunc(timeout, fire)}
+}
+
+// reader returns a reader that delivers the contents of r and resets the
+// watchdog whenever data are read.
+func (w *watchdog) reader(r io.Reader) io.Reader {
+	if w == nil {
+		return r
+	}
+	return watchReader{r: r, w: w}
+}
+
+// reset restarts the watchdog timeout.
+func (w *watchdog) reset() {
+	if w != nil {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+// stop pauses the watchdog until the next reset.
+func (w *watchdog) stop() {
+	if w != nil {
+		w.timer.Stop()
+	}
+}
+
+type watchReader struct {
+	r io.Reader
+	w *watchdog
+}
+
+func (r watchReader) Read(data []byte) (int, error) {
+	nr, err := r.r.Read(data)
+	if nr > 0 {
+		r.w.reset()
+	}
+	return nr, err
+}
@@ -0,0 +1,92 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted is the placeholder substituted for secret values in log output.
+const Redacted = "[REDACTED]"
+
+// isSecretParam reports whether name is the name of a parameter or field
+// whose value should not be written to logs.
+func isSecretParam(name string) bool {
+	switch name {
+	case "oauth_version", "oauth_signature_method", "oauth_timestamp", "oauth_callback":
+		return false // these are not secret
+	case "access_token", "refresh_token", "token", "client_secret", "password":
+		return true
+	}
+	return strings.HasPrefix(name, "oauth_")
+}
+
+// RedactAuthorization returns a copy of the value of an HTTP Authorization
+// header with its secrets replaced by Redacted. The authorization scheme is
+// preserved, as are the non-secret parameters of an OAuth header.
+func RedactAuthorization(value string) string {
+	scheme, rest, ok := strings.Cut(value, " ")
+	if !ok {
+		return Redacted
+	} else if !strings.EqualFold(scheme, "OAuth") {
+		return scheme + " " + Redacted
+	}
+	args := strings.Split(rest, ",")
+	for i, arg := range args {
+		key, _, ok := strings.Cut(strings.TrimSpace(arg), "=")
+		if !ok || isSecretParam(key) {
+			args[i] = " " + key + `="` + Redacted + `"`
+		}
+	}
+	return scheme + " " + strings.TrimSpace(strings.Join(args, ","))
+}
+
+// RedactURL returns a copy of the URL string u with the values of any secret
+// query parameters replaced by Redacted.
+func RedactURL(u string) string {
+	base, query, ok := strings.Cut(u, "?")
+	if !ok {
+		return u
+	}
+	return base + "?" + redactForm(query)
+}
+
+// redactForm redacts the values of secret parameters in a URL-encoded query.
+// The order and encoding of other parameters is preserved.
+func redactForm(query string) string {
+	terms := strings.Split(query, "&")
+	for i, term := range terms {
+		key, _, ok := strings.Cut(term, "=")
+		if name, err := url.QueryUnescape(key); ok && err == nil && isSecretParam(name) {
+			terms[i] = key + "=" + url.QueryEscape(Redacted)
+		}
+	}
+	return strings.Join(terms, "&")
+}
+
+// jsonSecretField matches a JSON object field with a string value, whose name
+// may be a secret parameter.
+var jsonSecretField = regexp.MustCompile(`"(\w+)"(\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// RedactBody returns a copy of the request or response body data as a string,
+// with the values of secret JSON fields or form parameters replaced by
+// Redacted. For example, the access_token field of an OAuth 2 bearer token
+// response is redacted.
+func RedactBody(data []byte) string {
+	s := string(data)
+	if t := strings.TrimSpace(s); strings.HasPrefix(t, "{") || strings.HasPrefix(t, "[") {
+		return jsonSecretField.ReplaceAllStringFunc(s, func(field string) string {
+			m := jsonSecretField.FindStringSubmatch(field)
+			if !isSecretParam(m[1]) {
+				return field
+			}
+			return `"` + m[1] + `"` + m[2] + `"` + Redacted + `"`
+		})
+	}
+	if strings.Contains(s, "=") && !strings.ContainsAny(s, " \t\r\n") {
+		return redactForm(s) // probably a URL-encoded form
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape_test
+
+import (
+	"testing"
+
+	"github.com/creachadair/twitter/jape"
+)
+
+func TestRedact(t *testing.T) {
+	t.Run("Authorization", func(t *testing.T) {
+		tests := []struct {
+			input, want string
+		}{
+			{"Bearer s3cr3t", "Bearer [REDACTED]"},
+			{"Basic dXNlcjpwYXNz", "Basic [REDACTED]"},
+			{"garbage", "[REDACTED]"},
+			{`OAuth oauth_consumer_key="key", oauth_token="tok", oauth_nonce="n", ` +
+				`oauth_timestamp="1191242096", oauth_signature_method="HMAC-SHA1", ` +
+				`oauth_version="1.0", oauth_signature="sig"`,
+				`OAuth oauth_consumer_key="[REDACTED]", oauth_token="[REDACTED]", oauth_nonce="[REDACTED]", ` +
+					`oauth_timestamp="1191242096", oauth_signature_method="HMAC-SHA1", ` +
+					`oauth_version="1.0", oauth_signature="[REDACTED]"`},
+		}
+		for _, test := range tests {
+			if got := jape.RedactAuthorization(test.input); got != test.want {
+				t.Errorf("RedactAuthorization(%q):\ngot:  %s\nwant: %s", test.input, got, test.want)
+			}
+		}
+	})
+
+	t.Run("URL", func(t *testing.T) {
+		tests := []struct {
+			input, want string
+		}{
+			{"https://api.twitter.com/2/tweets", "https://api.twitter.com/2/tweets"},
+			{"https://api.twitter.com/2/tweets?ids=1,2", "https://api.twitter.com/2/tweets?ids=1,2"},
+			{"https://api.twitter.com/oauth/access_token?oauth_token=abc&oauth_verifier=123",
+				"https://api.twitter.com/oauth/access_token?oauth_token=%5BREDACTED%5D&oauth_verifier=%5BREDACTED%5D"},
+		}
+		for _, test := range tests {
+			if got := jape.RedactURL(test.input); got != test.want {
+				t.Errorf("RedactURL(%q):\ngot:  %s\nwant: %s", test.input, got, test.want)
+			}
+		}
+	})
+
+	t.Run("Body", func(t *testing.T) {
+		tests := []struct {
+			input, want string
+		}{
+			{`{"data":{"id":"12"}}`, `{"data":{"id":"12"}}`},
+			{`{"token_type":"bearer","access_token":"AAAA%2FAAA="}`,
+				`{"token_type":"bearer","access_token":"[REDACTED]"}`},
+			{"oauth_token=abc&oauth_token_secret=def&user_id=12",
+				"oauth_token=%5BREDACTED%5D&oauth_token_secret=%5BREDACTED%5D&user_id=12"},
+			{"some plain text = value", "some plain text = value"},
+		}
+		for _, test := range tests {
+			if got := jape.RedactBody([]byte(test.input)); got != test.want {
+				t.Errorf("RedactBody(%q):\ngot:  %s\nwant: %s", test.input, got, test.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package replay
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/creachadair/twitter/jape"
+)
+
+// cassetteVersion is the version of the go-vcr cassette format supported.
+const cassetteVersion = 1
+
+// A cassette is the encoded format of a recording file.
+type cassette struct {
+	Version      int            `yaml:"version"`
+	Interactions []*interaction `yaml:"interactions"`
+}
+
+// An interaction is a single recorded request and its response.
+type interaction struct {
+	Request  request  `yaml:"request"`
+	Response response `yaml:"response"`
+}
+
+type request struct {
+	Body    string      `yaml:"body"`
+	Form    url.Values  `yaml:"form"`
+	Headers http.Header `yaml:"headers"`
+	URL     string      `yaml:"url"`
+	Method  string      `yaml:"method"`
+}
+
+type response struct {
+	Body     string      `yaml:"body"`
+	Headers  http.Header `yaml:"headers"`
+	Status   string      `yaml:"status"`
+	Code     int         `yaml:"code"`
+	Duration string      `yaml:"duration"`
+}
+
+// scrub replaces the secrets in the request and response of in.
+func (in *interaction) scrub() {
+	q := &in.Request
+	if auth := q.Headers.Values("Authorization"); len(auth) != 0 {
+		for i, v := range auth {
+			auth[i] = jape.RedactAuthorization(v)
+		}
+	}
+	q.URL = jape.RedactURL(q.URL)
+	q.Body = jape.RedactBody([]byte(q.Body))
+	q.Form = formValues(q.Headers.Get("Content-Type"), q.Body)
+	in.Response.Body = jape.RedactBody([]byte(in.Response.Body))
+}
+
+// matchKey returns a string that is equal for requests matching r.
+func (r *request) matchKey() string {
+	return matchKeyFor(r.Method, r.URL, r.Headers.Get("Content-Type"), r.Body)
+}
+
+// matchKeyFor returns a string that is equal for requests that match each
+// other, in which the parameters of the URL and of a form body are ordered
+// canonically, and secret values are removed. A multipart body is compared by
+// the names and contents of its parts, since its boundary is chosen anew for
+// each request.
+func matchKeyFor(method, rawURL, ctype, body string) string {
+	target := rawURL
+	if u, err := url.Parse(jape.RedactURL(rawURL)); err == nil {
+		u.RawQuery = canonicalForm(u.Query())
+		u.Fragment = ""
+		target = u.String()
+	}
+	if isForm(ctype) {
+		// Redact before parsing, since the recorded body was redacted.
+		if v, err := url.ParseQuery(jape.RedactBody([]byte(body))); err == nil {
+			body = canonicalForm(v)
+		}
+	} else if parts, ok := canonicalParts(ctype, body); ok {
+		body = parts
+	} else {
+		body = jape.RedactBody([]byte(body))
+	}
+	return method + " " + target + "\n" + body
+}
+
+// canonicalForm encodes v in order by parameter name, omitting oauth_*
+// parameters, whose values vary from one request to the next.
+func canonicalForm(v url.Values) string {
+	for name := range v {
+		if strings.HasPrefix(name, "oauth_") {
+			delete(v, name)
+		}
+	}
+	return v.Encode()
+}
+
+// canonicalParts encodes the parts of a multipart body without its boundary.
+// It reports false if ctype is not multipart or body cannot be parsed.
+func canonicalParts(ctype, body string) (string, bool) {
+	mt, params, err := mime.ParseMediaType(ctype)
+	if err != nil || !strings.HasPrefix(mt, "multipart/") || params["boundary"] == "" {
+		return "", false
+	}
+	mr := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	var sb strings.Builder
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", false
+		}
+		data, err := io.ReadAll(p)
+		if err != nil {
+			return "", false
+		}
+		sb.WriteString(strconv.Quote(p.FormName()) + " " + strconv.Quote(p.FileName()) + " ")
+		sb.WriteString(strconv.Quote(jape.RedactBody(data)) + "\n")
+	}
+	return sb.String(), true
+}
+
+// toHTTP returns an HTTP response to req containing the recorded response.
+func (r *response) toHTTP(req *http.Request) *http.Response {
+	status := r.Status
+	if status == "" {
+		status = strconv.Itoa(r.Code) + " " + http.StatusText(r.Code)
+	}
+	header := r.Headers.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        status,
+		StatusCode:    r.Code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
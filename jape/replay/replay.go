@@ -0,0 +1,350 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+// Package replay implements an HTTP transport that records interactions with
+// an API server to a file, and replays them later without contacting the
+// server. This is useful for testing code that uses the API.
+//
+// Usage outline
+//
+//	rt, err := replay.Open("testdata/record.yaml", replay.Replay, nil)
+//	if err != nil {
+//	   log.Fatalf("Opening replay file: %v", err)
+//	}
+//	defer rt.Close()
+//
+//	cli := twitter.NewClient(&jape.Client{
+//	   HTTPClient: &http.Client{Transport: rt},
+//	   Authorize:  jape.BearerTokenAuthorizer("fake-token"),
+//	})
+//
+// The recording file is a YAML document in the cassette format used by the
+// github.com/dnaeon/go-vcr package, so existing recordings can be replayed.
+//
+// # Secrets
+//
+// When recording, the transport scrubs credentials from each interaction
+// before it is saved: The secrets of the Authorization header are replaced
+// with jape.Redacted, as are the values of oauth_* parameters (other than the
+// non-secret protocol parameters such as oauth_timestamp) and other secret
+// parameters in the URL and in form or JSON bodies. Response bodies are
+// scrubbed in the same way, so that tokens issued by the server are not
+// saved.
+//
+// # Matching
+//
+// When replaying, a request matches a recorded interaction if they have the
+// same method, URL path, and parameters, and the same body. Query and form
+// parameters may appear in any order, and oauth_* parameters and redacted
+// values are ignored, since they vary from one request to the next. Multipart
+// bodies, such as media uploads, match if their parts have the same names and
+// contents, regardless of the boundary. Headers are not compared.
+//
+// Each recorded interaction is replayed at most once, in the order they were
+// recorded, so that a sequence of identical requests receives the sequence of
+// recorded responses. Once every matching interaction has been replayed, the
+// last of them is replayed again for subsequent matching requests.
+//
+// # Streams
+//
+// The transport reads the complete response body before returning it to the
+// caller, so a stream would never complete. To record streaming methods, the
+// transport truncates the bodies of streaming responses to a fixed size (see
+// Options).
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creachadair/twitter/jape"
+	"gopkg.in/yaml.v3"
+)
+
+// A Mode determines how a Transport handles requests.
+type Mode int
+
+const (
+	// Replay answers requests from the recorded interactions, without
+	// contacting the server. A request that has no recorded interaction
+	// reports ErrNotRecorded.
+	Replay Mode = iota
+
+	// Record sends requests to the server and records the interactions,
+	// replacing any previous recording. The recording is written when the
+	// Transport is closed.
+	Record
+
+	// Passthrough sends requests to the server and does not record them.
+	Passthrough
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Replay:
+		return "replay"
+	case Record:
+		return "record"
+	case Passthrough:
+		return "passthrough"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// DefaultStreamBytes is the default limit on the size of a recorded
+// streaming response body.
+const DefaultStreamBytes = 12000
+
+// ErrNotRecorded is reported in Replay mode for a request that does not match
+// any recorded interaction.
+var ErrNotRecorded = errors.New("no recorded interaction for request")
+
+// Options control the behaviour of a Transport. A nil *Options is ready for
+// use and provides default values as described.
+type Options struct {
+	// The transport used to send requests to the server when recording or in
+	// passthrough mode. If nil, use http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// When recording, truncate the bodies of streaming responses to at most
+	// this many bytes. If zero, use DefaultStreamBytes.
+	//
+	// You want as small a limit as possible so as not to blow up the size of
+	// the recording, but if it's too small the client will fail spuriously.
+	MaxStreamBytes int64
+
+	// When recording, truncate the bodies of other responses to at most this
+	// many bytes. If zero, these bodies are not truncated.
+	MaxBodyBytes int64
+
+	// Reports whether the response to req is a stream. If nil, a request is
+	// treated as a stream if its URL path ends in "/stream".
+	IsStream func(req *http.Request) bool
+}
+
+func (o *Options) transport() http.RoundTripper {
+	if o == nil || o.Transport == nil {
+		return http.DefaultTransport
+	}
+	return o.Transport
+}
+
+// bodyLimit returns the maximum size of a recorded response body for req, or
+// 0 if it is not limited.
+func (o *Options) bodyLimit(req *http.Request) int64 {
+	isStream := strings.HasSuffix(req.URL.Path, "/stream")
+	if o != nil && o.IsStream != nil {
+		isStream = o.IsStream(req)
+	}
+	if !isStream {
+		if o == nil {
+			return 0
+		}
+		return o.MaxBodyBytes
+	}
+	if o == nil || o.MaxStreamBytes <= 0 {
+		return DefaultStreamBytes
+	}
+	return o.MaxStreamBytes
+}
+
+// A Transport is an http.RoundTripper that records or replays interactions
+// with a server. Use Open to create a Transport.
+//
+// A Transport is safe for concurrent use by multiple goroutines, but when
+// replaying, the order in which identical concurrent requests receive their
+// responses is unspecified.
+type Transport struct {
+	path string
+	mode Mode
+	opts *Options
+
+	μ     sync.Mutex
+	cas   *cassette
+	used  []bool // parallel to cas.Interactions
+	dirty bool
+}
+
+// Open returns a Transport that records or replays the interactions in the
+// file at path, according to mode. In Replay mode, the file must exist.  In
+// Record mode, the file is created or replaced when the Transport is closed.
+// In Passthrough mode, path is ignored.
+func Open(path string, mode Mode, opts *Options) (*Transport, error) {
+	t := &Transport{path: path, mode: mode, opts: opts, cas: &cassette{Version: cassetteVersion}}
+	switch mode {
+	case Replay:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, t.cas); err != nil {
+			return nil, fmt.Errorf("decoding %q: %w", path, err)
+		} else if t.cas.Version != cassetteVersion {
+			return nil, fmt.Errorf("decoding %q: unsupported version %d", path, t.cas.Version)
+		}
+		t.used = make([]bool, len(t.cas.Interactions))
+	case Record:
+		if path == "" {
+			return nil, errors.New("no recording path specified")
+		}
+	case Passthrough:
+	default:
+		return nil, fmt.Errorf("invalid mode %v", mode)
+	}
+	return t, nil
+}
+
+// Mode reports the mode of t.
+func (t *Transport) Mode() Mode { return t.mode }
+
+// Close releases the resources of t. In Record mode, Close writes the
+// recorded interactions to the file.
+func (t *Transport) Close() error {
+	t.μ.Lock()
+	defer t.μ.Unlock()
+	if t.mode != Record || !t.dirty {
+		return nil
+	}
+	data, err := yaml.Marshal(t.cas)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(t.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(t.path, append([]byte("---\n"), data...), 0644); err != nil {
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch t.mode {
+	case Passthrough:
+		return t.opts.transport().RoundTrip(req)
+	case Record:
+		return t.record(req)
+	default:
+		return t.replay(req)
+	}
+}
+
+// readBody returns the body of req, and replaces it with a fresh reader so
+// that the request can still be sent.
+func readBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	return string(data), nil
+}
+
+func (t *Transport) record(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading request body: %w", err)
+	}
+	start := time.Now()
+	rsp, err := t.opts.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the response (or as much of it as we are permitted) so that it can
+	// be recorded, and replace it with the recorded copy.
+	var src io.Reader = rsp.Body
+	if n := t.opts.bodyLimit(req); n > 0 {
+		src = io.LimitReader(rsp.Body, n)
+	}
+	data, err := io.ReadAll(src)
+	rsp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	elapsed := time.Since(start)
+
+	in := &interaction{
+		Request: request{
+			Body:    body,
+			Form:    formValues(req.Header.Get("Content-Type"), body),
+			Headers: req.Header.Clone(),
+			URL:     req.URL.String(),
+			Method:  req.Method,
+		},
+		Response: response{
+			Body:     string(data),
+			Headers:  rsp.Header.Clone(),
+			Status:   rsp.Status,
+			Code:     rsp.StatusCode,
+			Duration: elapsed.String(),
+		},
+	}
+	in.scrub()
+	t.μ.Lock()
+	t.cas.Interactions = append(t.cas.Interactions, in)
+	t.dirty = true
+	t.μ.Unlock()
+
+	rsp.Body = io.NopCloser(bytes.NewReader(data))
+	rsp.ContentLength = int64(len(data))
+	rsp.Header.Del("Content-Length")
+	return rsp, nil
+}
+
+func (t *Transport) replay(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading request body: %w", err)
+	}
+	want := matchKeyFor(req.Method, req.URL.String(), req.Header.Get("Content-Type"), body)
+
+	t.μ.Lock()
+	defer t.μ.Unlock()
+	last := -1
+	for i, in := range t.cas.Interactions {
+		if in.Request.matchKey() != want {
+			continue
+		}
+		last = i
+		if !t.used[i] {
+			t.used[i] = true
+			return in.Response.toHTTP(req), nil
+		}
+	}
+	if last >= 0 {
+		return t.cas.Interactions[last].Response.toHTTP(req), nil
+	}
+	return nil, fmt.Errorf("%s %s: %w", req.Method, jape.RedactURL(req.URL.String()), ErrNotRecorded)
+}
+
+// formValues returns the parsed form parameters of body if ctype indicates a
+// URL-encoded form, otherwise an empty set.
+func formValues(ctype, body string) url.Values {
+	if isForm(ctype) {
+		if v, err := url.ParseQuery(body); err == nil {
+			return v
+		}
+	}
+	return url.Values{}
+}
+
+func isForm(ctype string) bool {
+	return strings.HasPrefix(ctype, "application/x-www-form-urlencoded")
+}
@@ -0,0 +1,254 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package replay_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/jape/replay"
+)
+
+const (
+	secretToken  = "very-secret-bearer-token"
+	secretOAuth  = "very-secret-oauth-token"
+	secretIssued = "very-secret-issued-token"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		switch req.URL.Path {
+		case "/stream":
+			w.Write([]byte(strings.Repeat("x", 1000)))
+		case "/token":
+			fmt.Fprintf(w, `{"token_type":"bearer","access_token":%q}`, secretIssued)
+		default:
+			fmt.Fprintf(w, "call %d: %s", calls, req.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "record.yaml")
+	get := func(t *testing.T, rt http.RoundTripper, url, auth string) (string, error) {
+		t.Helper()
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rsp, err := rt.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer rsp.Body.Close()
+		data, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatalf("Reading body: %v", err)
+		}
+		return string(data), nil
+	}
+
+	// Record some interactions, including secrets and a stream.
+	rec, err := replay.Open(path, replay.Record, &replay.Options{MaxStreamBytes: 100})
+	if err != nil {
+		t.Fatalf("Open for recording: %v", err)
+	}
+	recorded := make(map[string]string)
+	for _, url := range []string{
+		"/a?x=1&y=2",
+		"/a?x=1&y=2",
+		"/b?oauth_token=" + secretOAuth + "&oauth_nonce=123&z=3",
+		"/stream",
+		"/token",
+	} {
+		body, err := get(t, rec, srv.URL+url, "Bearer "+secretToken)
+		if err != nil {
+			t.Fatalf("Recording %q: %v", url, err)
+		}
+		recorded[url] += body
+	}
+	if got := len(recorded["/stream"]); got != 100 {
+		t.Errorf("Recorded stream length: got %d, want 100", got)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Closing recorder: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading recording: %v", err)
+	}
+	for _, secret := range []string{secretToken, secretOAuth, secretIssued} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Recording contains secret %q", secret)
+		}
+	}
+
+	// Replay the interactions, with the parameters in a different order and
+	// with different credentials.
+	calls = 0
+	rp, err := replay.Open(path, replay.Replay, nil)
+	if err != nil {
+		t.Fatalf("Open for replay: %v", err)
+	}
+	defer rp.Close()
+	for _, test := range []struct {
+		url, want string
+	}{
+		{"/a?y=2&x=1", "call 1: /a"},
+		{"/a?y=2&x=1", "call 2: /a"},
+		{"/a?x=1&y=2", "call 2: /a"}, // the last match is reused
+		{"/b?z=3&oauth_nonce=456&oauth_token=other", recorded["/b?oauth_token="+secretOAuth+"&oauth_nonce=123&z=3"]},
+		{"/stream", strings.Repeat("x", 100)},
+	} {
+		got, err := get(t, rp, srv.URL+test.url, "Bearer fake")
+		if err != nil {
+			t.Errorf("Replay %q: unexpected error: %v", test.url, err)
+		} else if got != test.want {
+			t.Errorf("Replay %q: got %q, want %q", test.url, got, test.want)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("Replay contacted the server %d times", calls)
+	}
+
+	if _, err := get(t, rp, srv.URL+"/a?x=1&y=3", ""); !errors.Is(err, replay.ErrNotRecorded) {
+		t.Errorf("Replay unrecorded: got %v, want %v", err, replay.ErrNotRecorded)
+	}
+}
+
+func TestReplayMultipart(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		f, _, err := req.FormFile("media")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		fmt.Fprintf(w, `{"media_id_string":"%d","size":%d}`, calls, len(data))
+	}))
+	defer srv.Close()
+
+	// upload sends a multipart request like a media upload. Each request
+	// chooses a new boundary, so the bodies of identical uploads differ.
+	upload := func(t *testing.T, rt http.RoundTripper, category, content string) (string, error) {
+		t.Helper()
+		var m jape.Multipart
+		m.AddField("media_category", category)
+		m.AddReader("media", "image.png", strings.NewReader(content), int64(len(content)))
+		cli := &jape.Client{HTTPClient: &http.Client{Transport: rt}, BaseURL: srv.URL}
+		_, body, err := cli.Call(context.Background(), &jape.Request{
+			Method:     "1.1/media/upload.json",
+			HTTPMethod: "POST",
+			Multipart:  &m,
+		})
+		return string(body), err
+	}
+
+	path := filepath.Join(t.TempDir(), "upload.yaml")
+	rec, err := replay.Open(path, replay.Record, nil)
+	if err != nil {
+		t.Fatalf("Open for recording: %v", err)
+	}
+	want, err := upload(t, rec, "tweet_image", "PNG data")
+	if err != nil {
+		t.Fatalf("Recording upload: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Closing recorder: %v", err)
+	}
+
+	calls = 0
+	rp, err := replay.Open(path, replay.Replay, nil)
+	if err != nil {
+		t.Fatalf("Open for replay: %v", err)
+	}
+	defer rp.Close()
+	if got, err := upload(t, rp, "tweet_image", "PNG data"); err != nil {
+		t.Errorf("Replay upload: unexpected error: %v", err)
+	} else if got != want {
+		t.Errorf("Replay upload: got %q, want %q", got, want)
+	}
+	if _, err := upload(t, rp, "tweet_image", "other data"); !errors.Is(err, replay.ErrNotRecorded) {
+		t.Errorf("Replay different upload: got %v, want %v", err, replay.ErrNotRecorded)
+	}
+	if calls != 0 {
+		t.Errorf("Replay contacted the server %d times", calls)
+	}
+}
+
+func TestReplaySecretForm(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		fmt.Fprintf(w, `{"access_token":%q}`, req.FormValue("access_token"))
+	}))
+	defer srv.Close()
+
+	// post sends a form body with a secret parameter, as when invalidating a
+	// bearer token.
+	post := func(t *testing.T, rt http.RoundTripper, token string) (string, error) {
+		t.Helper()
+		req, err := http.NewRequest("POST", srv.URL+"/oauth2/invalidate_token",
+			strings.NewReader("access_token="+token+"&x=1"))
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rsp, err := rt.RoundTrip(req)
+		if err != nil {
+			return "", err
+		}
+		defer rsp.Body.Close()
+		data, err := io.ReadAll(rsp.Body)
+		return string(data), err
+	}
+
+	path := filepath.Join(t.TempDir(), "form.yaml")
+	rec, err := replay.Open(path, replay.Record, nil)
+	if err != nil {
+		t.Fatalf("Open for recording: %v", err)
+	}
+	want, err := post(t, rec, secretIssued)
+	if err != nil {
+		t.Fatalf("Recording: %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Closing recorder: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil {
+		t.Fatalf("Reading recording: %v", err)
+	} else if strings.Contains(string(data), secretIssued) {
+		t.Errorf("Recording contains secret %q", secretIssued)
+	}
+
+	calls = 0
+	rp, err := replay.Open(path, replay.Replay, nil)
+	if err != nil {
+		t.Fatalf("Open for replay: %v", err)
+	}
+	defer rp.Close()
+	if got, err := post(t, rp, "other-secret"); err != nil {
+		t.Errorf("Replay: unexpected error: %v", err)
+	} else if got != jape.RedactBody([]byte(want)) {
+		t.Errorf("Replay: got %q, want %q", got, jape.RedactBody([]byte(want)))
+	}
+	if calls != 0 {
+		t.Errorf("Replay contacted the server %d times", calls)
+	}
+}
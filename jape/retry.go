@@ -0,0 +1,173 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Default settings for a RetryPolicy.
+const (
+	DefaultMaxAttempts = 3
+	DefaultMinDelay    = 500 * time.Millisecond
+	DefaultMaxDelay    = 30 * time.Second
+)
+
+// A RetryPolicy controls how a Client retries requests that fail with a
+// transient error. A request is retried if issuing it failed at the transport
+// level, or if the server reported status 429 (Too Many Requests) or a 5xx
+// server error.
+//
+// Only requests with idempotent HTTP methods (GET, DELETE, PUT) are retried,
+// unless the request sets its Retryable field to opt in.
+//
+// A nil *RetryPolicy does not retry any requests.
+type RetryPolicy struct {
+	// The maximum number of attempts to make for a single request, including
+	// the first. If zero, use DefaultMaxAttempts.
+	MaxAttempts int
+
+	// The base delay before the first retry. Subsequent retries double the
+	// previous delay, up to MaxDelay, and each delay is jittered.
+	// If zero, use DefaultMinDelay.
+	MinDelay time.Duration
+
+	// The maximum delay between attempts. If the server requests a longer wait
+	// than this (via Retry-After or x-rate-limit-reset), the request is not
+	// retried and the error is reported to the caller.
+	// If zero, use DefaultMaxDelay.
+	MaxDelay time.Duration
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil {
+		return 1
+	} else if p.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) minDelay() time.Duration {
+	if p.MinDelay <= 0 {
+		return DefaultMinDelay
+	}
+	return p.MinDelay
+}
+
+func (p *RetryPolicy) maxDelay() time.Duration {
+	if p.MaxDelay <= 0 {
+		return DefaultMaxDelay
+	}
+	return p.MaxDelay
+}
+
+// retryDelay reports whether req should be retried after the specified
+// attempt (1-based) failed with err, and if so how long to wait before
+// retrying.  The header h may be nil.
+func (p *RetryPolicy) retryDelay(attempt int, req *Request, h http.Header, err error) (time.Duration, bool) {
+	if attempt >= p.maxAttempts() || !req.canRetry() || !IsTransient(err) {
+		return 0, false
+	}
+	if d, ok := serverDelay(h, time.Now()); ok {
+		if d > p.maxDelay() {
+			return 0, false // the server wants us to wait longer than we will
+		}
+		return d, true
+	}
+
+	d := p.minDelay() << (attempt - 1)
+	if d <= 0 || d > p.maxDelay() {
+		d = p.maxDelay()
+	}
+
+	// Jitter the delay uniformly in the upper half of its range, so that
+	// concurrent clients do not retry in lockstep.
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+// IsTransient reports whether err is an error from a Client that may succeed
+// if the request is retried: A failure to issue the request at the transport
+// level (see ErrTransport), status 429 (Too Many Requests), or a 5xx server
+// error other than 501 (Not Implemented). The termination of a context is not
+// transient.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch {
+	case e.Status == 0:
+		return errors.Is(err, ErrTransport)
+	case e.Status == http.StatusTooManyRequests:
+		return true
+	case e.Status >= 500 && e.Status <= 599:
+		return e.Status != http.StatusNotImplemented
+	}
+	return false
+}
+
+// ErrTransport is the underlying error reported when a request could not be
+// issued at the transport level, for example because the connection to the
+// server failed. The error from the transport is also wrapped, so errors.Is and
+// errors.As see both.
+var ErrTransport = errors.New("transport failure")
+
+// A transportError wraps an error reported by the HTTP transport, and matches
+// ErrTransport.
+type transportError struct{ err error }
+
+func (e transportError) Error() string        { return e.err.Error() }
+func (e transportError) Unwrap() error        { return e.err }
+func (e transportError) Is(target error) bool { return target == ErrTransport }
+
+// serverDelay reports how long the server asked the client to wait before
+// retrying, based on the Retry-After or x-rate-limit-reset headers of h.
+func serverDelay(h http.Header, now time.Time) (time.Duration, bool) {
+	if h == nil {
+		return 0, false
+	}
+	if ra := h.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if t, err := http.ParseTime(ra); err == nil {
+			return nonNegative(t.Sub(now)), true
+		}
+	}
+	if h.Get("x-rate-limit-remaining") == "0" {
+		if v, err := strconv.ParseInt(h.Get("x-rate-limit-reset"), 10, 64); err == nil {
+			return nonNegative(time.Unix(v, 0).Sub(now)), true
+		}
+	}
+	return 0, false
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// sleep waits for d to elapse or ctx to end, whichever comes first.
+// It reports an error if ctx ended before d elapsed.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
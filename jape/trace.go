@@ -0,0 +1,197 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package jape
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// A Tracer creates spans for the requests issued by a Client. An
+// implementation may adapt any tracing system; to use it, set it as the
+// Tracer of a client.
+//
+// A Client opens one span for each Call, CallJSON, or Stream, covering all
+// retries and reconnections of the request. The span is given the following
+// attributes, as they become known:
+//
+//	endpoint     -- the endpoint of the request, e.g., "GET 2/users/:id"
+//	page_token   -- the pagination token sent with the request, if any
+//	attempt      -- the number of the current (or final) attempt, from 1
+//	status       -- the HTTP status of the most recent response
+//	messages     -- for a stream, the number of messages received
+//
+// Each request sent to the API carries a W3C traceparent header naming the
+// span (see TraceContext).
+type Tracer interface {
+	// Start begins a new span with the given name as a child of any span
+	// associated with ctx, and returns a context associated with the span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// A Span represents a unit of work traced by a Tracer.
+type Span interface {
+	// SetAttributes adds or replaces attributes of the span.
+	SetAttributes(attrs ...slog.Attr)
+
+	// TraceContext returns the W3C trace context identifying the span, for
+	// propagation to the server. If it returns an invalid TraceContext, the
+	// client derives one from the context as if there were no tracer.
+	TraceContext() TraceContext
+
+	// End completes the span. If the operation failed, err != nil.
+	End(err error)
+}
+
+// TraceContext is a W3C trace context, identifying a span within a trace.
+// See https://www.w3.org/TR/trace-context/.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte // e.g., TraceSampled
+}
+
+// TraceSampled is the flag of a TraceContext indicating that the caller may
+// have recorded trace data.
+const TraceSampled = 0x01
+
+// IsValid reports whether tc has a non-zero trace ID and span ID.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// String encodes tc in the format of a traceparent header.
+func (tc TraceContext) String() string {
+	return fmt.Sprintf("00-%x-%x-%02x", tc.TraceID[:], tc.SpanID[:], tc.Flags)
+}
+
+// Child returns a TraceContext in the same trace as tc, with a new randomly
+// chosen span ID.
+func (tc TraceContext) Child() TraceContext {
+	for {
+		rand.Read(tc.SpanID[:])
+		if tc.SpanID != [8]byte{} {
+			return tc
+		}
+	}
+}
+
+// ParseTraceParent parses the value of a traceparent header.
+func ParseTraceParent(s string) (TraceContext, error) {
+	var tc TraceContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, errors.New("invalid traceparent format")
+	} else if parts[0] == "00" && len(parts) != 4 {
+		return tc, errors.New("invalid traceparent format")
+	}
+	var flags [1]byte
+	for _, f := range []struct {
+		dst []byte
+		src string
+	}{{tc.TraceID[:], parts[1]}, {tc.SpanID[:], parts[2]}, {flags[:], parts[3]}} {
+		if len(f.src) != 2*len(f.dst) || strings.ToLower(f.src) != f.src {
+			return TraceContext{}, errors.New("invalid traceparent field")
+		} else if _, err := hex.Decode(f.dst, []byte(f.src)); err != nil {
+			return TraceContext{}, fmt.Errorf("invalid traceparent field: %w", err)
+		}
+	}
+	tc.Flags = flags[0]
+	if !tc.IsValid() {
+		return TraceContext{}, errors.New("invalid trace or span ID")
+	}
+	return tc, nil
+}
+
+type traceContextKey struct{}
+
+// ContextWithTrace returns a copy of ctx that carries the trace context tc.
+// Requests issued with the resulting context, in the absence of a Tracer,
+// carry a traceparent header for a child of tc. This allows a service to
+// propagate a trace from an inbound request without a tracer:
+//
+//	if tc, err := jape.ParseTraceParent(req.Header.Get("traceparent")); err == nil {
+//	   ctx = jape.ContextWithTrace(ctx, tc)
+//	}
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceFromContext returns the trace context associated with ctx by
+// ContextWithTrace, and reports whether there was one.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok && tc.IsValid()
+}
+
+type spanContextKey struct{}
+
+func spanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanContextKey{}).(Span)
+	return span
+}
+
+// pageTokenParams are the names of request parameters that carry pagination
+// tokens, in order of preference.
+var pageTokenParams = []string{"pagination_token", "next_token", "cursor"}
+
+// startSpan starts a span for req with the given name, if c has a tracer.
+// The resulting span is nil if c has no tracer.
+func (c *Client) startSpan(ctx context.Context, name string, req *Request) (context.Context, Span) {
+	if c.Tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := c.Tracer.Start(ctx, name)
+	attrs := []slog.Attr{
+		slog.String("endpoint", req.Endpoint()),
+		slog.Int("attempt", 1),
+	}
+	for _, name := range pageTokenParams {
+		if tok := req.Params[name]; len(tok) != 0 && tok[0] != "" {
+			attrs = append(attrs, slog.String("page_token", tok[0]))
+			break
+		}
+	}
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// endSpan ends span, if it is not nil, recording the status of err.
+func endSpan(span Span, err error) {
+	if span == nil {
+		return
+	}
+	var e *Error
+	if errors.As(err, &e) && e.Status != 0 {
+		span.SetAttributes(slog.Int("status", e.Status))
+	}
+	span.End(err)
+}
+
+// setSpanAttrs sets attributes on the span associated with ctx, if any.
+func setSpanAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if span := spanFromContext(ctx); span != nil {
+		span.SetAttributes(attrs...)
+	}
+}
+
+// setTraceParent adds a traceparent header to hreq, if its context carries a
+// span with a valid trace context or a trace context from ContextWithTrace.
+func setTraceParent(hreq *http.Request) {
+	ctx := hreq.Context()
+	if span := spanFromContext(ctx); span != nil {
+		if tc := span.TraceContext(); tc.IsValid() {
+			hreq.Header.Set("traceparent", tc.String())
+			return
+		}
+	}
+	if tc, ok := TraceFromContext(ctx); ok {
+		hreq.Header.Set("traceparent", tc.Child().String())
+	}
+}
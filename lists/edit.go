@@ -20,11 +20,11 @@ type Edit struct {
 
 // Invoke executes the query on the given context and client. A successful
 // response reports whether the edit took effect.
-func (e Edit) Invoke(ctx context.Context, cli *twitter.Client) (bool, error) {
+func (e Edit) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (bool, error) {
 	if e.encodeErr != nil {
 		return false, e.encodeErr // deferred encoding error
 	}
-	rsp, err := cli.Call(ctx, e.Request)
+	rsp, err := cli.Call(ctx, e.Request, opts...)
 	if err != nil {
 		return false, err
 	}
@@ -44,6 +44,7 @@ func (e Edit) Invoke(ctx context.Context, cli *twitter.Client) (bool, error) {
 func Delete(id string) Edit {
 	req := &jape.Request{
 		Method:     "2/lists/" + id,
+		Template:   "2/lists/:id",
 		HTTPMethod: "DELETE",
 	}
 	return Edit{Request: req, tag: "deleted"}
@@ -55,6 +56,7 @@ func Delete(id string) Edit {
 func Update(id string, opts UpdateOpts) Edit {
 	req := &jape.Request{
 		Method:     "2/lists/" + id,
+		Template:   "2/lists/:id",
 		HTTPMethod: "PUT",
 	}
 	body, err := json.Marshal(opts)
@@ -69,6 +71,7 @@ func Update(id string, opts UpdateOpts) Edit {
 func AddMember(listID, userID string) Edit {
 	req := &jape.Request{
 		Method:     "2/lists/" + listID + "/members",
+		Template:   "2/lists/:id/members",
 		HTTPMethod: "POST",
 	}
 	body, err := json.Marshal(struct {
@@ -85,6 +88,7 @@ func AddMember(listID, userID string) Edit {
 func RemoveMember(listID, userID string) Edit {
 	req := &jape.Request{
 		Method:     "2/lists/" + listID + "/members/" + userID,
+		Template:   "2/lists/:id/members/:id",
 		HTTPMethod: "DELETE",
 	}
 	return Edit{Request: req, tag: "is_member"}
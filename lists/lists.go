@@ -21,8 +21,9 @@ import (
 // API: 2/lists
 func Lookup(id string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/lists/" + id,
-		Params: make(jape.Params),
+		Method:   "2/lists/" + id,
+		Template: "2/lists/:id",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -34,8 +35,9 @@ func Lookup(id string, opts *ListOpts) Query {
 // API: 2/users/:id/owned_lists
 func OwnedBy(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/owned_lists",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/owned_lists",
+		Template: "2/users/:id/owned_lists",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -47,8 +49,9 @@ func OwnedBy(userID string, opts *ListOpts) Query {
 // API: 2/users/:id/followed_lists
 func FollowedBy(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/followed_lists",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/followed_lists",
+		Template: "2/users/:id/followed_lists",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -60,8 +63,9 @@ func FollowedBy(userID string, opts *ListOpts) Query {
 // API: 2/users/:id/pinned_lists
 func PinnedBy(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/pinned_lists",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/pinned_lists",
+		Template: "2/users/:id/pinned_lists",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -73,8 +77,9 @@ func PinnedBy(userID string, opts *ListOpts) Query {
 // API: 2/users/:id/list_memberships
 func MemberOf(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/list_memberships",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/list_memberships",
+		Template: "2/users/:id/list_memberships",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -106,8 +111,9 @@ func Create(name, description string, private bool) Query {
 // API: 2/lists/:id/members
 func Members(listID string, opts *ListOpts) users.Query {
 	req := &jape.Request{
-		Method: "2/lists/" + listID + "/members",
-		Params: make(jape.Params),
+		Method:   "2/lists/" + listID + "/members",
+		Template: "2/lists/:id/members",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return users.Query{Request: req}
@@ -119,8 +125,9 @@ func Members(listID string, opts *ListOpts) users.Query {
 // API: 2/lists/:id/followers
 func Followers(listID string, opts *ListOpts) users.Query {
 	req := &jape.Request{
-		Method: "2/lists/" + listID + "/followers",
-		Params: make(jape.Params),
+		Method:   "2/lists/" + listID + "/followers",
+		Template: "2/lists/:id/followers",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return users.Query{Request: req}
@@ -132,8 +139,9 @@ func Followers(listID string, opts *ListOpts) users.Query {
 // API: 2/lists/:id/tweets
 func Tweets(listID string, opts *ListOpts) tweets.Query {
 	req := &jape.Request{
-		Method: "2/lists/" + listID + "/tweets",
-		Params: make(jape.Params),
+		Method:   "2/lists/" + listID + "/tweets",
+		Template: "2/lists/:id/tweets",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return tweets.Query{Request: req}
@@ -146,11 +154,11 @@ type Query struct {
 }
 
 // Invoke executes the query on the given context and client.
-func (q Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
+func (q Query) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (*Reply, error) {
 	if q.encodeErr != nil {
 		return nil, q.encodeErr // deferred encoding error
 	}
-	rsp, err := cli.Call(ctx, q.Request)
+	rsp, err := cli.Call(ctx, q.Request, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -194,6 +202,19 @@ func (q Query) HasMorePages() bool {
 // invoking the query will then fetch the first page of results.
 func (q Query) ResetPageToken() { q.Request.Params.Reset(twitter.NextTokenParam) }
 
+// Pager returns a pager over the lists reported by q. The pager does not
+// modify q.
+func (q Query) Pager(opts *twitter.PageOpts) *twitter.Pager[*types.List] {
+	params := twitter.PageParams{Token: twitter.NextTokenParam, Size: "max_results"}
+	return twitter.NewPager(q.Request, params, func(ctx context.Context, cli *twitter.Client, req *jape.Request, copts ...twitter.CallOption) (*twitter.Page[*types.List], error) {
+		rsp, err := Query{Request: req, encodeErr: q.encodeErr}.Invoke(ctx, cli, copts...)
+		if err != nil {
+			return nil, err
+		}
+		return &twitter.Page[*types.List]{Items: rsp.Lists, Next: rsp.Meta.Next(), Reply: rsp.Reply}, nil
+	}, opts)
+}
+
 // A Reply is the response from a Query.
 type Reply struct {
 	*twitter.Reply
@@ -201,6 +222,12 @@ type Reply struct {
 	Meta  *twitter.Pagination
 }
 
+// Hydrate resolves the expansions of the lists in r using the includes of r.
+// See twitter.HydrateLists.
+func (r *Reply) Hydrate() (*twitter.Hydrated[*twitter.ListNode], error) {
+	return twitter.HydrateLists(r.Reply, r.Lists)
+}
+
 // ListOpts provide parameters for list queries.  A nil *ListOpts provides
 // empty values for all fields.
 type ListOpts struct {
@@ -59,9 +59,22 @@ func (q Query) HasMorePages() bool { return ocall.HasMorePages(q.Request) }
 // invoking the query will then fetch the first page of results.
 func (q Query) ResetPageToken() { ocall.ResetPageToken(q.Request) }
 
+// Pager returns a pager over the users reported by q. The pager does not
+// modify q.
+func (q Query) Pager(opts *twitter.PageOpts) *twitter.Pager[*types.User] {
+	params := twitter.PageParams{Token: ocall.NextTokenParam, Size: "count"}
+	return twitter.NewPager(q.Request, params, func(ctx context.Context, cli *twitter.Client, req *jape.Request, copts ...twitter.CallOption) (*twitter.Page[*types.User], error) {
+		rsp, err := ocall.GetUsers(ctx, req, q.opts, cli, copts...)
+		if err != nil {
+			return nil, err
+		}
+		return &twitter.Page[*types.User]{Items: rsp.Users, Next: rsp.NextToken}, nil
+	}, opts)
+}
+
 // Invoke executes the query and returns the matching users.
-func (q Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
-	return ocall.GetUsers(ctx, q.Request, q.opts, cli)
+func (q Query) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (*Reply, error) {
+	return ocall.GetUsers(ctx, q.Request, q.opts, cli, opts...)
 }
 
 // ListOpts provides parameters for list queries.  A nil *ListOpts provides
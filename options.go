@@ -0,0 +1,131 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/creachadair/twitter/jape"
+)
+
+// A CallOption customizes a single call to the API, without modifying the
+// client or the query. Call options are accepted by the Call, CallRaw, and
+// Stream methods of a Client, and by the Invoke method of each query type.
+// Options are applied in order, so a later option overrides an earlier one
+// with the same effect.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout   time.Duration
+	header    http.Header
+	setAuth   bool
+	authorize jape.Authorizer
+	baseURL   string
+	all       bool
+}
+
+// WithTimeout bounds the duration of the call, including any retries. For a
+// stream, the stream ends when the timeout expires.
+func WithTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) { o.timeout = d }
+}
+
+// WithHeader sets the specified HTTP header on the request, replacing any
+// value set by an earlier option. See the Header field of jape.Request.
+func WithHeader(name, value string) CallOption {
+	return func(o *callOptions) {
+		if o.header == nil {
+			o.header = make(http.Header)
+		}
+		o.header.Set(name, value)
+	}
+}
+
+// WithAuthorizer authorizes the request with auth instead of the client's
+// authorizer. If auth == nil, the request is sent without authorization.
+// The request does not use the client's Cache or Coalescer, since the reply
+// may differ from one caller to another, nor its Limiter or Breaker, since the
+// rate limits and health of the API may differ too.
+func WithAuthorizer(auth jape.Authorizer) CallOption {
+	return func(o *callOptions) { o.setAuth = true; o.authorize = auth }
+}
+
+// WithBaseURL sends the request to the specified base URL instead of the
+// client's base URL. As with WithAuthorizer, the request does not use the
+// client's Cache, Coalescer, Limiter, or Breaker.
+func WithBaseURL(url string) CallOption {
+	return func(o *callOptions) { o.baseURL = url }
+}
+
+// WithRequireAll makes a lookup report an error if the reply does not include
+// every requested object, for example because some of the requested IDs do
+// not exist. The error wraps a *MissingError, which reports the missing IDs
+// or usernames along with the reply. This option applies to lookups that
+// specify their objects by ID or username, such as tweets.Lookup and
+// users.LookupByName; it has no effect on other calls. In a bulk lookup such
+// as users.LookupAll, the merged reply of all the batches is checked, so the
+// error reports the missing objects of every batch.
+func WithRequireAll() CallOption {
+	return func(o *callOptions) { o.all = true }
+}
+
+// RequiresAll reports whether opts include WithRequireAll. A bulk lookup uses
+// this to decide whether to check its merged reply with CheckMissing.
+func RequiresAll(opts []CallOption) bool { return newCallOptions(opts).all }
+
+func newCallOptions(opts []CallOption) callOptions {
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// withOptions returns the context, client, and request to use for a call of
+// req on c with the given options, and a function to release the resources of
+// the context when the call is complete. The client and request are shallow
+// copies if the options require changes; otherwise c and req are returned.
+func (c *Client) withOptions(ctx context.Context, req *jape.Request, opts []CallOption) (context.Context, *Client, *jape.Request, context.CancelFunc) {
+	if len(opts) == 0 {
+		return ctx, c, req, func() {}
+	}
+	o := newCallOptions(opts)
+	cancel := func() {}
+	if o.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+	}
+	if o.setAuth || o.baseURL != "" {
+		cp := *c // shallow copy
+		if o.setAuth {
+			cp.Authorize = o.authorize
+		}
+		if o.baseURL != "" {
+			cp.BaseURL = o.baseURL
+		}
+
+		// The keys of the cache and coalescer do not include the credentials or
+		// the base URL, so sharing them could return a reply fetched by another
+		// caller, or from another server. Likewise, rate limits are counted per
+		// credential and server, and another server may be healthy when the
+		// client's is not, so the limiter and breaker do not apply either.
+		cp.Cache = nil
+		cp.Coalescer = nil
+		cp.Limiter = nil
+		cp.Breaker = nil
+		c = &cp
+	}
+	if len(o.header) != 0 {
+		cp := *req // shallow copy; N.B. the query parameters are shared
+		cp.Header = req.Header.Clone()
+		if cp.Header == nil {
+			cp.Header = make(http.Header)
+		}
+		for name, vals := range o.header {
+			cp.Header[name] = vals
+		}
+		req = &cp
+	}
+	return ctx, c, req, cancel
+}
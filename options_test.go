@@ -0,0 +1,126 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/users"
+)
+
+func TestCallOptions(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("slow") != "" {
+			select {
+			case <-req.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		got = req.Header.Clone()
+		w.Write([]byte(`{"data":[{"id":"12","username":"jack"}]}`))
+	}))
+	defer srv.Close()
+
+	cli := twitter.NewClient(&jape.Client{
+		HTTPClient: srv.Client(),
+		BaseURL:    "http://invalid.example.com", // overridden per call
+		Authorize:  jape.BearerTokenAuthorizer("client-token"),
+	})
+	ctx := context.Background()
+	base := twitter.WithBaseURL(srv.URL)
+
+	q := users.Lookup("12", nil)
+	rsp, err := q.Invoke(ctx, cli, base,
+		twitter.WithHeader("X-Test", "ok"),
+		twitter.WithAuthorizer(jape.BearerTokenAuthorizer("call-token")),
+	)
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if len(rsp.Users) != 1 || rsp.Users[0].Username != "jack" {
+		t.Errorf("Invoke: got %+v, want user jack", rsp.Users)
+	}
+	if v := got.Get("X-Test"); v != "ok" {
+		t.Errorf("X-Test header: got %q, want ok", v)
+	}
+	if v := got.Get("Authorization"); v != "Bearer call-token" {
+		t.Errorf("Authorization: got %q, want call-token", v)
+	}
+	if q.Request.Header != nil {
+		t.Errorf("Query header was modified: %v", q.Request.Header)
+	}
+
+	// Without options, the client's settings apply.
+	if _, err := q.Invoke(ctx, cli, base); err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	if v := got.Get("Authorization"); v != "Bearer client-token" {
+		t.Errorf("Authorization: got %q, want client-token", v)
+	}
+	if v := got.Get("X-Test"); v != "" {
+		t.Errorf("X-Test header: got %q, want none", v)
+	}
+
+	// A timeout bounds the call.
+	_, err = cli.Call(ctx, &jape.Request{Method: "2/users", Params: jape.Params{"slow": {"1"}}},
+		base, twitter.WithTimeout(10*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Call with timeout: got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCallOptionsCache(t *testing.T) {
+	var auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auths = append(auths, req.Header.Get("Authorization"))
+		w.Header().Set("x-rate-limit-limit", "1")
+		w.Header().Set("x-rate-limit-remaining", "0")
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		w.Write([]byte(`{"data":[{"id":"12","username":"jack"}]}`))
+	}))
+	defer srv.Close()
+
+	cli := twitter.NewClient(&jape.Client{
+		HTTPClient: srv.Client(),
+		BaseURL:    srv.URL,
+		Cache:      &jape.Cache{TTL: time.Hour},
+		Coalescer:  new(jape.Coalescer),
+		Limiter:    &twitter.RateLimiter{Policy: twitter.FailFast},
+		Breaker:    new(jape.CircuitBreaker),
+	})
+	ctx := context.Background()
+
+	// The client's own budget is spent, but does not apply to other credentials.
+	if _, err := users.Lookup("12", nil).Invoke(ctx, cli); err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	auths = nil
+	for _, token := range []string{"user-a", "user-b", "user-a"} {
+		rsp, err := users.Lookup("12", nil).Invoke(ctx, cli,
+			twitter.WithAuthorizer(jape.BearerTokenAuthorizer(token)))
+		if err != nil {
+			t.Fatalf("Invoke for %s failed: %v", token, err)
+		} else if len(rsp.Users) != 1 {
+			t.Errorf("Invoke for %s: got %d users, want 1", token, len(rsp.Users))
+		}
+	}
+	want := "[Bearer user-a Bearer user-b Bearer user-a]"
+	if got := fmt.Sprint(auths); got != want {
+		t.Errorf("Requests: got %s, want %s", got, want)
+	}
+	var rle *twitter.RateLimitError
+	if _, err := users.Lookup("13", nil).Invoke(ctx, cli); !errors.As(err, &rle) {
+		t.Errorf("Invoke with the client's credentials: got %v, want %T", err, rle)
+	}
+}
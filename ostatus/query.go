@@ -106,8 +106,8 @@ type Query struct {
 }
 
 // Invoke posts the update and reports the resulting tweet.
-func (o Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
-	data, err := cli.CallRaw(ctx, o.Request)
+func (o Query) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (*Reply, error) {
+	data, err := cli.CallRaw(ctx, o.Request, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -279,8 +279,8 @@ type TimelineQuery struct {
 }
 
 // Invoke posts the query and reports the matching tweets.
-func (o TimelineQuery) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
-	data, err := cli.CallRaw(ctx, o.Request)
+func (o TimelineQuery) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (*Reply, error) {
+	data, err := cli.CallRaw(ctx, o.Request, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -297,3 +297,31 @@ func (o TimelineQuery) Invoke(ctx context.Context, cli *twitter.Client) (*Reply,
 		Tweets: v2s,
 	}, nil
 }
+
+// Pager returns a pager over the tweets in the timeline, from newest to
+// oldest. The pager does not modify o.
+//
+// The v1.1 timeline API does not issue page tokens. Instead, each page after
+// the first is requested with a max_id parameter one less than the ID of the
+// last tweet on the preceding page, and the timeline ends with an empty page.
+func (o TimelineQuery) Pager(opts *twitter.PageOpts) *twitter.Pager[*types.Tweet] {
+	params := twitter.PageParams{Token: "max_id", Size: "count"}
+	return twitter.NewPager(o.Request, params, func(ctx context.Context, cli *twitter.Client, req *jape.Request, copts ...twitter.CallOption) (*twitter.Page[*types.Tweet], error) {
+		rsp, err := TimelineQuery{Request: req, opts: o.opts}.Invoke(ctx, cli, copts...)
+		if err != nil {
+			return nil, err
+		} else if len(rsp.Tweets) == 0 {
+			return new(twitter.Page[*types.Tweet]), nil
+		}
+		return &twitter.Page[*types.Tweet]{Items: rsp.Tweets, Next: prevID(rsp.Tweets[len(rsp.Tweets)-1].ID)}, nil
+	}, opts)
+}
+
+// prevID returns the tweet ID one less than id, or "" if there is none.
+func prevID(id string) string {
+	v, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || v == 0 {
+		return ""
+	}
+	return strconv.FormatUint(v-1, 10)
+}
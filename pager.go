@@ -0,0 +1,205 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/creachadair/twitter/jape"
+)
+
+// PageParams name the request parameters a paged query uses to select a page
+// of results.
+type PageParams struct {
+	Token string // the page token, e.g., "pagination_token" or "cursor"
+	Size  string // the number of results per page, e.g., "max_results"
+}
+
+// A Page is a single page of results fetched by a PageFunc.
+type Page[T any] struct {
+	Items []T
+	Next  string // the token for the next page, or "" if there are no more
+	Reply *Reply // the reply for the page, if it is a v2 reply; otherwise nil
+}
+
+// A PageFunc fetches a single page of results by sending req.
+type PageFunc[T any] func(ctx context.Context, cli *Client, req *jape.Request, opts ...CallOption) (*Page[T], error)
+
+// PageOpts provides parameters for a Pager. A nil *PageOpts provides zero
+// values for all fields.
+type PageOpts struct {
+	// The maximum number of items to deliver; 0 means no limit.
+	MaxItems int
+
+	// The number of items to request per page; 0 means let the server choose.
+	PageSize int
+
+	// If set, resume from this cursor as reported by the Cursor method of an
+	// earlier pager for the same query.
+	Cursor Cursor
+
+	// If non-nil, the includes of each page fetched are added to Includes.
+	Includes *Includes
+}
+
+// A Cursor records the position of a Pager in the results of its query.
+// A Cursor can be encoded as JSON, so that paging can be resumed later.
+type Cursor struct {
+	// The token of the page to fetch next; "" for the first page.
+	Token string `json:"token,omitempty"`
+
+	// The number of items from the start of the page that have already been
+	// delivered, and are skipped when the page is fetched.
+	Skip int `json:"skip,omitempty"`
+
+	// Whether there are no more pages to fetch.
+	Done bool `json:"done,omitempty"`
+}
+
+// A Pager fetches the results of a paged query one page at a time. Query types
+// that support paging have a Pager method that constructs a pager:
+//
+//	p := tweets.SearchRecent(query, nil).Pager(&twitter.PageOpts{MaxItems: 500})
+//	for p.More() {
+//	   page, err := p.NextPage(ctx, cli)
+//	   if err != nil {
+//	      return err
+//	   }
+//	   handle(page)
+//	}
+//
+// A pager does not modify the query from which it was constructed. The Cursor
+// method reports the position of the pager, which may be stored and passed to
+// a new pager to resume from where the old one stopped. A Pager is not safe
+// for concurrent use by multiple goroutines.
+type Pager[T any] struct {
+	req    *jape.Request
+	params PageParams
+	fetch  PageFunc[T]
+	max    int
+	size   int
+	cur    Cursor
+	seen   int
+	incs   *Includes
+}
+
+// NewPager constructs a pager that fetches pages of results for req using
+// fetch. The page token and size are set in a copy of req using the parameter
+// names given by params. If the cursor has no token, the first page uses the
+// page token already set in req, if any.
+func NewPager[T any](req *jape.Request, params PageParams, fetch PageFunc[T], opts *PageOpts) *Pager[T] {
+	p := &Pager[T]{req: req, params: params, fetch: fetch}
+	if opts != nil {
+		p.max = opts.MaxItems
+		p.size = opts.PageSize
+		p.cur = opts.Cursor
+		p.incs = opts.Includes
+	}
+	return p
+}
+
+// More reports whether p may have more items to deliver.
+func (p *Pager[T]) More() bool {
+	return !p.cur.Done && (p.max <= 0 || p.seen < p.max)
+}
+
+// Cursor reports the current position of p.
+func (p *Pager[T]) Cursor() Cursor { return p.cur }
+
+// NextPage fetches and returns the next page of items. If the fetch fails, the
+// position of p is unchanged, so that calling NextPage again will retry it.
+// If p has no more items, NextPage returns nil, nil.
+func (p *Pager[T]) NextPage(ctx context.Context, cli *Client, opts ...CallOption) ([]T, error) {
+	if !p.More() {
+		return nil, nil
+	}
+	page, err := p.fetch(ctx, cli, p.pageRequest(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if p.incs != nil {
+		if err := p.incs.Add(page.Reply); err != nil {
+			return nil, err
+		}
+	}
+	items := page.Items
+	if p.cur.Skip < len(items) {
+		items = items[p.cur.Skip:]
+	} else {
+		items = nil
+	}
+	if p.max > 0 && p.seen+len(items) > p.max {
+		// Deliver only part of the page, and resume from the same page.
+		n := p.max - p.seen
+		items = items[:n]
+		p.cur.Skip += n
+		p.seen = p.max
+		return items, nil
+	}
+	p.seen += len(items)
+	p.cur = Cursor{Token: page.Next, Done: page.Next == ""}
+	return items, nil
+}
+
+// Pages returns an iterator over the remaining pages of p. Iteration stops
+// after the first error. With Go 1.23 and later, the result can be used in a
+// range statement:
+//
+//	for page, err := range p.Pages(ctx, cli) { ... }
+func (p *Pager[T]) Pages(ctx context.Context, cli *Client, opts ...CallOption) func(yield func([]T, error) bool) {
+	return func(yield func([]T, error) bool) {
+		for p.More() {
+			page, err := p.NextPage(ctx, cli, opts...)
+			if !yield(page, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Items returns an iterator over the remaining items of p, fetching pages as
+// needed. Iteration stops after the first error. With Go 1.23 and later, the
+// result can be used in a range statement:
+//
+//	for item, err := range p.Items(ctx, cli) { ... }
+//
+// If iteration is stopped early, the cursor of p reflects the position at the
+// end of the current page, not the last item yielded.
+func (p *Pager[T]) Items(ctx context.Context, cli *Client, opts ...CallOption) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		for p.More() {
+			page, err := p.NextPage(ctx, cli, opts...)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range page {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// pageRequest returns a copy of the request for p with the page parameters
+// set for the current position.
+func (p *Pager[T]) pageRequest() *jape.Request {
+	req := *p.req // shallow copy
+	req.Params = p.req.Params.Clone()
+	if req.Params == nil {
+		req.Params = make(jape.Params)
+	}
+	if p.cur.Token != "" {
+		req.Params.Set(p.params.Token, p.cur.Token)
+	} else if v := req.Params[p.params.Token]; len(v) != 0 && v[0] == "" {
+		// An exhausted query records an empty token; start over instead.
+		req.Params.Reset(p.params.Token)
+	}
+	if p.size > 0 && p.params.Size != "" {
+		req.Params.Set(p.params.Size, strconv.Itoa(p.size))
+	}
+	return &req
+}
@@ -0,0 +1,160 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/ostatus"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+)
+
+func TestPager(t *testing.T) {
+	const numTweets = 10
+	var sizes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		size, _ := strconv.Atoi(q.Get("max_results"))
+		if size == 0 {
+			size = 3
+		}
+		sizes = append(sizes, q.Get("max_results"))
+
+		// Page tokens are the offset of the first tweet on the page.
+		start, _ := strconv.Atoi(q.Get("next_token"))
+		var data []map[string]string
+		for i := start; i < start+size && i < numTweets; i++ {
+			data = append(data, map[string]string{"id": strconv.Itoa(i)})
+		}
+		meta := map[string]any{"result_count": len(data)}
+		if end := start + size; end < numTweets {
+			meta["next_token"] = strconv.Itoa(end)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"data":     data,
+			"meta":     meta,
+			"includes": map[string]any{"users": []map[string]string{{"id": "1"}, {"id": strconv.Itoa(100 + start)}}},
+		})
+	}))
+	defer srv.Close()
+
+	cli := twitter.NewClient(&jape.Client{HTTPClient: srv.Client(), BaseURL: srv.URL})
+	ctx := context.Background()
+	ids := func(ts []*types.Tweet) (out []string) {
+		for _, tw := range ts {
+			out = append(out, tw.ID)
+		}
+		return
+	}
+
+	t.Run("Pages", func(t *testing.T) {
+		sizes = nil
+		q := tweets.SearchRecent("cats", nil)
+		var inc twitter.Includes
+		p := q.Pager(&twitter.PageOpts{PageSize: 4, Includes: &inc})
+		var got []string
+		for p.More() {
+			page, err := p.NextPage(ctx, cli)
+			if err != nil {
+				t.Fatalf("NextPage failed: %v", err)
+			}
+			got = append(got, fmt.Sprint(ids(page)))
+		}
+		want := []string{"[0 1 2 3]", "[4 5 6 7]", "[8 9]"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Pages: got %v, want %v", got, want)
+		}
+		if fmt.Sprint(sizes) != "[4 4 4]" {
+			t.Errorf("Page sizes: got %v, want [4 4 4]", sizes)
+		}
+		if c := p.Cursor(); !c.Done {
+			t.Errorf("Cursor after last page: got %+v, want done", c)
+		}
+		if n := inc.Len("users"); n != 4 {
+			t.Errorf("Included users: got %d, want 4", n)
+		}
+		if !q.HasMorePages() {
+			t.Error("Pager modified the query")
+		}
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		q := tweets.SearchRecent("cats", nil)
+		var got []string
+		var cursor twitter.Cursor
+		for i := 0; i < 5; i++ {
+			p := q.Pager(&twitter.PageOpts{MaxItems: 2, Cursor: cursor})
+			p.Items(ctx, cli)(func(tw *types.Tweet, err error) bool {
+				if err != nil {
+					t.Fatalf("Items failed: %v", err)
+				}
+				got = append(got, tw.ID)
+				return true
+			})
+
+			// Round-trip the cursor through JSON, as a caller might store it.
+			data, err := json.Marshal(p.Cursor())
+			if err != nil {
+				t.Fatalf("Marshal cursor: %v", err)
+			}
+			cursor = twitter.Cursor{}
+			if err := json.Unmarshal(data, &cursor); err != nil {
+				t.Fatalf("Unmarshal cursor: %v", err)
+			}
+		}
+		if want := "[0 1 2 3 4 5 6 7 8 9]"; fmt.Sprint(got) != want {
+			t.Errorf("Resumed items: got %v, want %v", got, want)
+		}
+		if !cursor.Done {
+			t.Errorf("Final cursor: got %+v, want done", cursor)
+		}
+	})
+}
+
+func TestTimelinePager(t *testing.T) {
+	var maxIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		maxID := req.URL.Query().Get("max_id")
+		maxIDs = append(maxIDs, maxID)
+		top := 109
+		if maxID != "" {
+			top, _ = strconv.Atoi(maxID)
+		}
+		var data []map[string]string
+		for id := top; id > top-4 && id >= 100; id-- {
+			data = append(data, map[string]string{"id_str": strconv.Itoa(id)})
+		}
+		json.NewEncoder(w).Encode(data)
+	}))
+	defer srv.Close()
+
+	cli := twitter.NewClient(&jape.Client{HTTPClient: srv.Client(), BaseURL: srv.URL})
+	p := ostatus.UserTimeline("jack", nil).Pager(&twitter.PageOpts{MaxItems: 9})
+
+	var got []string
+	p.Items(context.Background(), cli)(func(tw *types.Tweet, err error) bool {
+		if err != nil {
+			t.Fatalf("Items failed: %v", err)
+		}
+		got = append(got, tw.ID)
+		return true
+	})
+	if want := "[109 108 107 106 105 104 103 102 101]"; fmt.Sprint(got) != want {
+		t.Errorf("Timeline: got %v, want %v", got, want)
+	}
+	if want := "[ 105 101]"; fmt.Sprint(maxIDs) != want {
+		t.Errorf("Timeline max_id: got %v, want %v", maxIDs, want)
+	}
+	if c := p.Cursor(); c.Done || c.Token != "101" || c.Skip != 1 {
+		t.Errorf("Timeline cursor: got %+v, want token 101, skip 1", c)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/types"
+)
+
+// A PartialKind classifies a PartialError.
+type PartialKind int
+
+// Constants for PartialKind.
+const (
+	PartialOther        PartialKind = iota // not otherwise classified
+	PartialNotFound                        // the object does not exist
+	PartialUnauthorized                    // the caller may not see the object
+	PartialSuspended                       // the object belongs to a suspended user
+	PartialUnavailable                     // the object is otherwise unavailable
+)
+
+var partialNames = map[PartialKind]string{
+	PartialOther:        "other",
+	PartialNotFound:     "not found",
+	PartialUnauthorized: "unauthorized",
+	PartialSuspended:    "suspended",
+	PartialUnavailable:  "unavailable",
+}
+
+func (k PartialKind) String() string {
+	if n, ok := partialNames[k]; ok {
+		return n
+	}
+	return "PartialKind" + strconv.Itoa(int(k))
+}
+
+// lookupParams are the names of the request parameters that carry the keys
+// of the objects requested by a lookup.
+var lookupParams = map[string]bool{"ids": true, "id": true, "usernames": true, "username": true}
+
+// A PartialError is a typed view of an error detail reported in an otherwise
+// successful reply, such as a lookup in which some of the requested objects
+// could not be found.
+type PartialError struct {
+	Kind         PartialKind
+	ResourceType string // e.g., "tweet" or "user"
+	Value        string // the ID or username of the object
+
+	// For an error resolving an expansion, the expansion field, for example
+	// "pinned_tweet_id". For an error about a requested object, "".
+	Field string
+
+	// The error detail reported by the server.
+	Detail *types.ErrorDetail
+}
+
+// Error implements the error interface.
+func (e *PartialError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s", e.ResourceType, e.Value, e.Kind)
+	if e.Field != "" {
+		msg += " (" + e.Field + ")"
+	}
+	return msg
+}
+
+// IsExpansion reports whether e describes an error resolving an expansion,
+// rather than an error about a requested object.
+func (e *PartialError) IsExpansion() bool { return e.Field != "" }
+
+func newPartialError(d *types.ErrorDetail) *PartialError {
+	e := &PartialError{ResourceType: d.ResourceType, Value: d.Value, Detail: d}
+	if !lookupParams[d.Parameter] {
+		e.Field = d.Parameter
+	}
+	switch strings.TrimPrefix(d.TypeURL, problemTypePrefix) {
+	case "resource-not-found":
+		e.Kind = PartialNotFound
+	case "not-authorized-for-resource":
+		e.Kind = PartialUnauthorized
+	case "resource-unavailable":
+		e.Kind = PartialUnavailable
+		if strings.Contains(strings.ToLower(d.Detail), "suspended") {
+			e.Kind = PartialSuspended
+		}
+	default:
+		switch d.Title {
+		case "Not Found Error":
+			e.Kind = PartialNotFound
+		case "Authorization Error":
+			e.Kind = PartialUnauthorized
+		}
+	}
+	return e
+}
+
+// PartialErrors is a collection of partial errors.
+type PartialErrors []*PartialError
+
+// PartialErrors returns a typed view of the error details of r, in order.
+// It returns nil if r reports no errors.
+func (r *Reply) PartialErrors() PartialErrors {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	out := make(PartialErrors, len(r.Errors))
+	for i, d := range r.Errors {
+		out[i] = newPartialError(d)
+	}
+	return out
+}
+
+// Find returns the first error in ps for the object of the specified resource
+// type and value, or nil. If resourceType == "", any resource type matches.
+func (ps PartialErrors) Find(resourceType, value string) *PartialError {
+	for _, p := range ps {
+		if p.Value == value && (resourceType == "" || p.ResourceType == resourceType) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Requested returns the errors in ps about requested objects, in order.
+func (ps PartialErrors) Requested() PartialErrors {
+	return ps.filter(func(p *PartialError) bool { return !p.IsExpansion() })
+}
+
+// Expansions returns the errors in ps about expansions, in order.
+func (ps PartialErrors) Expansions() PartialErrors {
+	return ps.filter((*PartialError).IsExpansion)
+}
+
+// OfKind returns the errors in ps of the specified kind, in order.
+func (ps PartialErrors) OfKind(kind PartialKind) PartialErrors {
+	return ps.filter(func(p *PartialError) bool { return p.Kind == kind })
+}
+
+func (ps PartialErrors) filter(keep func(*PartialError) bool) PartialErrors {
+	var out PartialErrors
+	for _, p := range ps {
+		if keep(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// A MissingError reports that a reply did not include every object requested
+// by a lookup. It is reported by a call with the WithRequireAll option.
+type MissingError struct {
+	// The requested IDs or usernames that are missing, in order of request.
+	Missing []string
+
+	// The partial errors reported for the missing objects. A missing object
+	// may have no corresponding error.
+	Errors PartialErrors
+
+	// The reply, including the objects that were found.
+	Reply *Reply
+}
+
+// Error implements the error interface.
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("%d requested objects missing from reply", len(e.Missing))
+}
+
+// checkMissing reports a *MissingError if rsp does not contain an object for
+// each ID or username requested by req. Requests that do not specify their
+// objects by the "ids" or "usernames" parameter are not checked.
+func checkMissing(req *jape.Request, rsp *Reply) error {
+	if ids, ok := req.Params["ids"]; ok {
+		return CheckMissing(rsp, "ids", ids)
+	} else if names, ok := req.Params["usernames"]; ok {
+		return CheckMissing(rsp, "usernames", names)
+	}
+	return nil
+}
+
+// CheckMissing reports an error wrapping a *MissingError if rsp does not
+// contain an object for each of the requested keys, as for a call with the
+// WithRequireAll option. The param is the name of the request parameter that
+// carried the keys: "ids" for IDs, or "usernames" for usernames, which are
+// compared without regard to case. Each key may be a comma-separated list.
+// This is useful to check the merged reply of a bulk lookup.
+func CheckMissing(rsp *Reply, param string, keys []string) error {
+	byName := param == "usernames"
+
+	vs, err := splitArray(rsp.Data)
+	if err != nil {
+		return &jape.Error{Data: rsp.Data, Message: "decoding reply data", Err: err}
+	}
+	found := make(map[string]bool, len(vs))
+	for _, v := range vs {
+		var obj struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		}
+		if err := json.Unmarshal(v, &obj); err != nil {
+			return &jape.Error{Data: rsp.Data, Message: "decoding reply data", Err: err}
+		}
+		if byName {
+			found[strings.ToLower(obj.Username)] = true
+		} else {
+			found[obj.ID] = true
+		}
+	}
+
+	me := &MissingError{Reply: rsp}
+	errs := rsp.PartialErrors().Requested()
+	for _, key := range keys {
+		for _, k := range strings.Split(key, ",") {
+			if byName && found[strings.ToLower(k)] || found[k] {
+				continue
+			}
+			me.Missing = append(me.Missing, k)
+			for _, p := range errs {
+				if strings.EqualFold(p.Value, k) {
+					me.Errors = append(me.Errors, p)
+				}
+			}
+		}
+	}
+	if len(me.Missing) == 0 {
+		return nil
+	}
+	return &jape.Error{Data: rsp.Data, Message: "incomplete reply", Err: me}
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/users"
+)
+
+const partialReply = `{
+  "data": [{"id": "1", "username": "one"}, {"id": "3", "username": "three"}],
+  "errors": [
+    {"value": "2", "detail": "Could not find user with ids: [2].", "title": "Not Found Error",
+     "resource_type": "user", "parameter": "ids", "resource_id": "2",
+     "type": "https://api.twitter.com/2/problems/resource-not-found"},
+    {"value": "4", "detail": "User has been suspended: [4].", "title": "Forbidden",
+     "resource_type": "user", "parameter": "ids", "resource_id": "4",
+     "type": "https://api.twitter.com/2/problems/resource-unavailable"},
+    {"value": "99", "detail": "Could not find tweet with pinned_tweet_id: [99].", "title": "Not Found Error",
+     "resource_type": "tweet", "parameter": "pinned_tweet_id", "resource_id": "99",
+     "type": "https://api.twitter.com/2/problems/resource-not-found"},
+    {"value": "6", "detail": "Sorry, you are not authorized to see the user with id: [6].",
+     "title": "Authorization Error", "resource_type": "user", "parameter": "ids", "resource_id": "6",
+     "type": "https://api.twitter.com/2/problems/not-authorized-for-resource"}
+  ]
+}`
+
+func TestPartialErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(partialReply))
+	}))
+	defer srv.Close()
+
+	cli := twitter.NewClient(&jape.Client{HTTPClient: srv.Client(), BaseURL: srv.URL})
+	ctx := context.Background()
+	q := users.Lookup("1", &users.LookupOpts{More: []string{"2", "3", "4", "5", "6"}})
+
+	rsp, err := q.Invoke(ctx, cli)
+	if err != nil {
+		t.Fatalf("Invoke failed: %v", err)
+	}
+	ps := rsp.PartialErrors()
+	for _, test := range []struct {
+		typ, value string
+		kind       twitter.PartialKind
+		field      string
+	}{
+		{"user", "2", twitter.PartialNotFound, ""},
+		{"user", "4", twitter.PartialSuspended, ""},
+		{"tweet", "99", twitter.PartialNotFound, "pinned_tweet_id"},
+		{"", "6", twitter.PartialUnauthorized, ""},
+	} {
+		p := ps.Find(test.typ, test.value)
+		if p == nil {
+			t.Errorf("Find(%q, %q): not found", test.typ, test.value)
+		} else if p.Kind != test.kind || p.Field != test.field {
+			t.Errorf("Find(%q, %q): got %v %q, want %v %q", test.typ, test.value, p.Kind, p.Field, test.kind, test.field)
+		}
+	}
+	if p := ps.Find("tweet", "2"); p != nil {
+		t.Errorf("Find(tweet, 2): got %v, want nil", p)
+	}
+	if n := len(ps.Requested()); n != 3 {
+		t.Errorf("Requested: got %d errors, want 3", n)
+	}
+	if n := len(ps.Expansions()); n != 1 {
+		t.Errorf("Expansions: got %d errors, want 1", n)
+	}
+
+	_, err = q.Invoke(ctx, cli, twitter.WithRequireAll())
+	var me *twitter.MissingError
+	if !errors.As(err, &me) {
+		t.Fatalf("Invoke with WithRequireAll: got %v, want *MissingError", err)
+	}
+	if got := fmt.Sprint(me.Missing); got != "[2 4 5 6]" {
+		t.Errorf("Missing: got %s, want [2 4 5 6]", got)
+	}
+	if len(me.Errors) != 3 || me.Errors[1].Kind != twitter.PartialSuspended {
+		t.Errorf("Missing errors: got %v, want [2 4 6]", me.Errors)
+	}
+
+	// Requests that do not name their objects by ID are not checked.
+	if _, err := users.FollowersOf("1", nil).Invoke(ctx, cli, twitter.WithRequireAll()); err != nil {
+		t.Errorf("FollowersOf with WithRequireAll: unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/creachadair/twitter/jape"
+)
+
+// A LimitPolicy determines what a RateLimiter does with a request whose
+// endpoint has no remaining budget in the current rate limit window.
+type LimitPolicy int
+
+const (
+	// WaitForReset blocks the request until the rate limit window resets, or
+	// until the request context ends.
+	WaitForReset LimitPolicy = iota
+
+	// FailFast aborts the request with a *RateLimitError.
+	FailFast
+
+	// Observe admits every request, and only records the rate limits reported
+	// by the server. Use this policy to monitor rate limits without enforcing
+	// them.
+	Observe
+)
+
+// A RateLimiter tracks the rate limits reported by the server for each API
+// endpoint, and uses them to hold or reject requests that the server would
+// otherwise refuse. A RateLimiter implements the jape.Limiter interface; to
+// use it, set it as the Limiter of a client:
+//
+//	lim := new(twitter.RateLimiter)
+//	cli := twitter.NewClient(&jape.Client{
+//	   Authorize: jape.BearerTokenAuthorizer(token),
+//	   Limiter:   lim,
+//	})
+//
+// Endpoints are identified by their jape.Request Endpoint string, for example
+// "GET 2/users/:id/followers". Until the server has reported a rate limit for
+// an endpoint, requests to that endpoint are not limited.
+//
+// The rate limits most recently reported by the server can be inspected with
+// the Snapshot method, or as JSON by serving the RateLimiter as an http.Handler,
+// for example on an administrative debug server:
+//
+//	mux.Handle("/debug/ratelimits", lim)
+//
+// The budget the limiter has left for each endpoint, which also counts the
+// requests admitted since the last report, is reported by the Budget method.
+//
+// A zero RateLimiter is ready for use with the WaitForReset policy. A
+// RateLimiter is safe for concurrent use by multiple goroutines, and may be
+// shared by multiple clients that share a rate limit budget. Its settings must
+// not be changed once it is in use.
+type RateLimiter struct {
+	// What to do with a request whose endpoint budget is exhausted.
+	Policy LimitPolicy
+
+	// If set, OnUpdate is called with each change in the rate limit reported
+	// by the server for an endpoint. It is called synchronously by the client
+	// that received the report, and must not block. Calls are serialized in the
+	// order the reports were recorded, so the Previous field of each event is
+	// the Limit of the one before it for the same endpoint.
+	OnUpdate func(RateLimitEvent)
+
+	ν        sync.Mutex            // serializes calls to OnUpdate
+	μ        sync.Mutex            // protects the fields below
+	buckets  map[string]*RateLimit // the admission budget for each endpoint
+	reported map[string]RateLimit  // the last limit reported by the server
+}
+
+// A RateLimitEvent reports a change in the rate limit for an endpoint.
+type RateLimitEvent struct {
+	Endpoint string     // e.g., "GET 2/users/:id/followers"
+	Limit    RateLimit  // the rate limit reported by the server
+	Previous *RateLimit // the rate limit previously recorded, or nil
+}
+
+// Admit implements part of the jape.Limiter interface. If the rate limit for
+// the endpoint of req is exhausted, Admit either waits for the window to reset
+// or reports a *RateLimitError, depending on the policy.
+func (r *RateLimiter) Admit(ctx context.Context, req *jape.Request) error {
+	if r.Policy == Observe {
+		return nil
+	}
+	endpoint := req.Endpoint()
+	for {
+		reset, ok := r.reserve(endpoint, time.Now())
+		if ok {
+			return nil
+		} else if r.Policy == FailFast {
+			return &RateLimitError{Endpoint: endpoint, Reset: reset}
+		}
+		t := time.NewTimer(time.Until(reset))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve attempts to reserve one request from the budget of endpoint as of
+// now. If no budget is available, it returns the time of the next reset.
+func (r *RateLimiter) reserve(endpoint string, now time.Time) (time.Time, bool) {
+	r.μ.Lock()
+	defer r.μ.Unlock()
+	b, ok := r.buckets[endpoint]
+	if !ok {
+		return time.Time{}, true // no limit is known for this endpoint
+	}
+	if !now.Before(b.Reset) {
+		// The window has reset since we last heard from the server. Assume the
+		// budget has been replenished; the next response will correct us.
+		b.Remaining = b.Ceiling
+		b.Reset = now.Add(DefaultRateLimitWindow)
+	}
+	if b.Remaining <= 0 {
+		return b.Reset, false
+	}
+	b.Remaining--
+	return time.Time{}, true
+}
+
+// DefaultRateLimitWindow is the assumed duration of a rate limit window, used
+// when a RateLimiter must guess when an expired window will next reset.
+const DefaultRateLimitWindow = 15 * time.Minute
+
+// Update implements part of the jape.Limiter interface. It records the rate
+// limit reported in h, if any, for the endpoint of req.
+func (r *RateLimiter) Update(req *jape.Request, h http.Header) {
+	rl := decodeRateLimits(h)
+	if rl == nil {
+		return
+	}
+	if r.OnUpdate != nil {
+		r.ν.Lock()
+		defer r.ν.Unlock()
+	}
+	endpoint := req.Endpoint()
+	r.μ.Lock()
+	if r.reported == nil {
+		r.reported = make(map[string]RateLimit)
+		r.buckets = make(map[string]*RateLimit)
+	}
+	old, known := r.reported[endpoint]
+	r.reported[endpoint] = *rl
+	if !rl.Reset.IsZero() {
+		// Without a reset time, we cannot schedule around the limit.
+		r.buckets[endpoint] = rl
+	}
+	r.μ.Unlock()
+
+	if r.OnUpdate != nil && (!known || old != *rl) {
+		e := RateLimitEvent{Endpoint: endpoint, Limit: *rl}
+		if known {
+			e.Previous = &old
+		}
+		r.OnUpdate(e)
+	}
+}
+
+// Snapshot returns a snapshot of the rate limits most recently reported by
+// the server for each endpoint, keyed by endpoint string. The caller may
+// modify the result.
+func (r *RateLimiter) Snapshot() map[string]RateLimit {
+	r.μ.Lock()
+	defer r.μ.Unlock()
+	out := make(map[string]RateLimit, len(r.reported))
+	for endpoint, rl := range r.reported {
+		out[endpoint] = rl
+	}
+	return out
+}
+
+// Budget returns a snapshot of the budget the limiter has left for each
+// endpoint, keyed by endpoint string. The budget starts from the rate limit
+// reported by the server, less the requests admitted since that report, and
+// is replenished when the window is expected to reset. Unlike Snapshot, this
+// is what Admit uses to decide whether to hold or reject a request. The caller
+// may modify the result.
+func (r *RateLimiter) Budget() map[string]RateLimit {
+	r.μ.Lock()
+	defer r.μ.Unlock()
+	out := make(map[string]RateLimit, len(r.buckets))
+	for endpoint, b := range r.buckets {
+		out[endpoint] = *b
+	}
+	return out
+}
+
+// ServeHTTP implements the http.Handler interface. It serves a JSON object
+// that maps each endpoint to its current rate limit, as reported by Snapshot.
+func (r *RateLimiter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, err := json.MarshalIndent(r.Snapshot(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// RateLimits returns a snapshot of the rate limits most recently reported by
+// the server for requests by c, keyed by endpoint string. A client returned by
+// NewClient records rate limits even if it was not given a limiter. It returns
+// nil if the limiter of c does not track rate limits.
+func (c *Client) RateLimits() map[string]RateLimit {
+	if s, ok := c.Limiter.(interface{ Snapshot() map[string]RateLimit }); ok {
+		return s.Snapshot()
+	}
+	return nil
+}
+
+// RateLimitError is the concrete type of the error reported when a
+// RateLimiter with the FailFast policy rejects a request.
+type RateLimitError struct {
+	Endpoint string    // the endpoint whose budget is exhausted
+	Reset    time.Time // when the rate limit window is expected to reset
+}
+
+// Error satisfies the error interface.
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s until %s", e.Endpoint, e.Reset.Format(time.RFC3339))
+}
@@ -0,0 +1,224 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+)
+
+func TestRateLimiter(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("x-rate-limit-limit", "2")
+		w.Header().Set("x-rate-limit-remaining", strconv.Itoa(2-int(n)))
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset, 10))
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer srv.Close()
+
+	lim := &twitter.RateLimiter{Policy: twitter.FailFast}
+	cli := twitter.NewClient(&jape.Client{
+		HTTPClient: srv.Client(),
+		BaseURL:    srv.URL,
+		Limiter:    lim,
+	})
+	ctx := context.Background()
+
+	for _, id := range []string{"1", "2"} {
+		if _, err := cli.Call(ctx, &jape.Request{Method: "2/users/" + id}); err != nil {
+			t.Fatalf("Call %s failed: %v", id, err)
+		}
+	}
+
+	// The budget is now exhausted, so the next call should fail without
+	// contacting the server.
+	_, err := cli.Call(ctx, &jape.Request{Method: "2/users/3"})
+	var rle *twitter.RateLimitError
+	if !errors.As(err, &rle) {
+		t.Fatalf("Call: got error %v, want %T", err, rle)
+	} else if rle.Endpoint != "GET 2/users/:id" {
+		t.Errorf("Error endpoint: got %q, want %q", rle.Endpoint, "GET 2/users/:id")
+	}
+	if calls != 2 {
+		t.Errorf("Got %d server calls, want 2", calls)
+	}
+
+	// Other endpoints are not affected.
+	if _, err := cli.Call(ctx, &jape.Request{Method: "2/tweets"}); err != nil {
+		t.Errorf("Call to another endpoint failed: %v", err)
+	}
+
+	snap := lim.Snapshot()
+	if rl, ok := snap["GET 2/users/:id"]; !ok {
+		t.Error("Snapshot is missing GET 2/users/:id")
+	} else if rl.Ceiling != 2 || rl.Remaining != 0 {
+		t.Errorf("Snapshot: got %+v, want ceiling 2, remaining 0", rl)
+	}
+
+	// The budget reflects requests admitted since the last report, while the
+	// snapshot reflects only what the server reported.
+	other := new(twitter.RateLimiter)
+	req := &jape.Request{Method: "2/tweets"}
+	h := make(http.Header)
+	h.Set("x-rate-limit-limit", "10")
+	h.Set("x-rate-limit-remaining", "5")
+	h.Set("x-rate-limit-reset", strconv.FormatInt(reset, 10))
+	other.Update(req, h)
+	for i := 0; i < 2; i++ {
+		if err := other.Admit(ctx, req); err != nil {
+			t.Fatalf("Admit failed: %v", err)
+		}
+	}
+	if rl := other.Snapshot()["GET 2/tweets"]; rl.Remaining != 5 {
+		t.Errorf("Snapshot: got %+v, want remaining 5", rl)
+	}
+	if rl := other.Budget()["GET 2/tweets"]; rl.Ceiling != 10 || rl.Remaining != 3 {
+		t.Errorf("Budget: got %+v, want ceiling 10, remaining 3", rl)
+	}
+
+	// With the WaitForReset policy, the request should block until the context
+	// ends.
+	lim.Policy = twitter.WaitForReset
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := cli.Call(tctx, &jape.Request{Method: "2/users/4"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Call: got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRateLimitTelemetry(t *testing.T) {
+	var remaining int32 = 10
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&remaining, -1)
+		w.Header().Set("x-rate-limit-limit", "10")
+		w.Header().Set("x-rate-limit-remaining", strconv.Itoa(int(max(n, 0))))
+		w.Header().Set("x-rate-limit-reset", "1700000000")
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer srv.Close()
+
+	var events []twitter.RateLimitEvent
+	lim := &twitter.RateLimiter{
+		Policy:   twitter.Observe,
+		OnUpdate: func(e twitter.RateLimitEvent) { events = append(events, e) },
+	}
+	cli := twitter.NewClient(&jape.Client{
+		HTTPClient: srv.Client(),
+		BaseURL:    srv.URL,
+		Limiter:    lim,
+	})
+	ctx := context.Background()
+
+	// The Observe policy does not hold requests even if the budget is spent.
+	for i := 0; i < 12; i++ {
+		if _, err := cli.Call(ctx, &jape.Request{Method: "2/users/" + strconv.Itoa(i) + "/followers"}); err != nil {
+			t.Fatalf("Call %d failed: %v", i, err)
+		}
+	}
+
+	// The last two replies report no change.
+	if len(events) != 10 {
+		t.Errorf("Got %d events, want 10", len(events))
+	} else if e := events[0]; e.Endpoint != "GET 2/users/:id/followers" || e.Previous != nil || e.Limit.Remaining != 9 {
+		t.Errorf("First event: got %+v, want remaining 9 and no previous", e)
+	} else if e := events[9]; e.Previous == nil || e.Previous.Remaining != 1 || e.Limit.Remaining != 0 {
+		t.Errorf("Last event: got %+v, want remaining 1 → 0", e)
+	}
+
+	snap := cli.RateLimits()
+	if rl := snap["GET 2/users/:id/followers"]; rl.Ceiling != 10 || rl.Remaining != 0 {
+		t.Errorf("RateLimits: got %+v, want ceiling 10, remaining 0", rl)
+	}
+
+	rec := httptest.NewRecorder()
+	lim.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/ratelimits", nil))
+	var got map[string]struct {
+		Ceiling   int       `json:"ceiling"`
+		Remaining int       `json:"remaining"`
+		Reset     time.Time `json:"reset"`
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type: got %q, want application/json", ct)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Decoding handler output: %v", err)
+	}
+	if rl := got["GET 2/users/:id/followers"]; rl.Ceiling != 10 || rl.Reset.Unix() != 1700000000 {
+		t.Errorf("Handler: got %+v, want ceiling 10 and reset 1700000000", rl)
+	}
+
+	// A client without a limiter still records the reported rate limits.
+	atomic.StoreInt32(&remaining, 5)
+	plain := twitter.NewClient(&jape.Client{HTTPClient: srv.Client(), BaseURL: srv.URL})
+	if _, err := plain.Call(ctx, &jape.Request{Method: "2/tweets"}); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if rl := plain.RateLimits()["GET 2/tweets"]; rl.Ceiling != 10 || rl.Remaining != 4 {
+		t.Errorf("RateLimits without a limiter: got %+v, want ceiling 10, remaining 4", rl)
+	}
+
+	// An enforcing limiter reports what the server said, not its own budget.
+	atomic.StoreInt32(&remaining, 5)
+	wait := new(twitter.RateLimiter)
+	cli = twitter.NewClient(&jape.Client{HTTPClient: srv.Client(), BaseURL: srv.URL, Limiter: wait})
+	for i := 0; i < 2; i++ {
+		if _, err := cli.Call(ctx, &jape.Request{Method: "2/tweets"}); err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+	}
+	if err := wait.Admit(ctx, &jape.Request{Method: "2/tweets"}); err != nil {
+		t.Fatalf("Admit failed: %v", err)
+	}
+	if rl := wait.Snapshot()["GET 2/tweets"]; rl.Remaining != 3 || rl.Reset.Unix() != 1700000000 {
+		t.Errorf("Snapshot: got %+v, want remaining 3 and reset 1700000000", rl)
+	}
+}
+
+func TestRateLimitEventOrder(t *testing.T) {
+	var events []twitter.RateLimitEvent
+	lim := &twitter.RateLimiter{
+		Policy:   twitter.Observe,
+		OnUpdate: func(e twitter.RateLimitEvent) { events = append(events, e) },
+	}
+	req := &jape.Request{Method: "2/tweets"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			h := make(http.Header)
+			h.Set("x-rate-limit-limit", "100")
+			h.Set("x-rate-limit-remaining", strconv.Itoa(i))
+			h.Set("x-rate-limit-reset", "1700000000")
+			lim.Update(req, h)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(events) != 50 {
+		t.Fatalf("Got %d events, want 50", len(events))
+	}
+	for i, e := range events[1:] {
+		if e.Previous == nil || *e.Previous != events[i].Limit {
+			t.Errorf("Event %d: previous %+v does not match prior limit %+v", i+1, e.Previous, events[i].Limit)
+		}
+	}
+	if last := events[len(events)-1].Limit; lim.Snapshot()["GET 2/tweets"] != last {
+		t.Errorf("Snapshot does not match the last event %+v", last)
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/creachadair/twitter/jape"
+)
+
+// DefaultTenantIdle is the duration after which a Registry evicts an idle
+// tenant, if not otherwise specified.
+const DefaultTenantIdle = 30 * time.Minute
+
+// ErrRevoked is reported for a request by a tenant client whose credentials
+// have been revoked by the Revoke method of its Registry.
+var ErrRevoked = errors.New("credentials revoked")
+
+// A Registry manages clients for an application that acts on behalf of many
+// users, each with their own user-context credentials. Each user is a tenant
+// of the registry, identified by a string chosen by the application, such as
+// a user ID. The client for a tenant is created when it is first requested,
+// and shares the HTTP transport and other policies of the base client:
+//
+//	reg := &twitter.Registry{
+//	   Base: &jape.Client{Authorize: jape.BearerTokenAuthorizer(appToken)},
+//	   Credentials: func(id string) (jape.Authorizer, error) {
+//	      tok, sec, err := db.LoadToken(id)
+//	      if err != nil {
+//	         return nil, err
+//	      }
+//	      return cfg.Authorizer(tok, sec), nil
+//	   },
+//	}
+//	cli, err := reg.Client(userID)
+//
+// Each tenant has its own RateLimiter, since the server applies user-context
+// rate limits separately to each user. Requests made by the application on
+// its own behalf, using the client returned by App, have a separate limiter.
+//
+// A tenant that has not sent a request for IdleTimeout, and has no calls in
+// progress, is evicted, and a new client is created if the tenant is requested
+// again. Eviction is lazy: idle tenants are checked when a client is
+// requested. A client that was evicted remains usable by a caller that still
+// holds it. By contrast, Revoke removes a tenant, ends any requests and
+// streams of its client in progress, and causes any further request by its
+// client to fail.
+//
+// A Registry is safe for concurrent use by multiple goroutines. Its settings
+// must not be changed once it is in use.
+type Registry struct {
+	// The base client from which tenant clients are derived. The clients for
+	// all tenants share its HTTP client (and thus its transport) and policies,
+	// except that each tenant has its own authorizer and limiter, and the app
+	// has its own limiter. The Limiter of Base is not used. The Cache and
+	// Coalescer of Base are not used by tenant clients, since replies to
+	// user-context requests may differ from one user to another.
+	//
+	// If Base == nil, default client options are used. Base must not be
+	// modified once the registry is in use.
+	Base *jape.Client
+
+	// Credentials returns the authorizer to use for requests by the specified
+	// tenant. It is called when a client for the tenant is first requested,
+	// and again after the tenant has been evicted or revoked. It may be slow,
+	// for example to read from a database; it does not block requests for the
+	// clients of other tenants.
+	Credentials func(tenant string) (jape.Authorizer, error)
+
+	// The rate limit policy for the limiters of tenants and of the app.
+	Policy LimitPolicy
+
+	// If set, OnRateLimit is called with each change in a rate limit reported
+	// by the server. For requests by the app, the tenant is "". It is called
+	// synchronously and must not block.
+	OnRateLimit func(tenant string, e RateLimitEvent)
+
+	// How long a tenant may be idle before it is evicted. If zero, use
+	// DefaultTenantIdle; if negative, tenants are never evicted.
+	IdleTimeout time.Duration
+
+	μ         sync.Mutex
+	base      *jape.Client // the base client with defaults filled in
+	app       *Client
+	appLimit  *RateLimiter
+	tenants   map[string]*tenant
+	loading   map[string]*tenantLoad // tenants whose credentials are loading
+	lastSweep time.Time
+}
+
+// A tenant is the state of an active tenant of a Registry.
+type tenant struct {
+	cli      *Client
+	limiter  *RateLimiter
+	lastUsed atomic.Int64 // Unix nanoseconds
+	revoked  atomic.Bool
+	active   atomic.Int32    // the number of calls in progress
+	ctx      context.Context // ends when the tenant is revoked
+	revoke   context.CancelFunc
+}
+
+// scope runs a call by the client of t, with a context that ends when t is
+// revoked. This covers the whole call, including waits for admission and
+// between retries, and the response body or stream. A call ended because t
+// was revoked reports an error wrapping ErrRevoked.
+func (t *tenant) scope(ctx context.Context, run func(context.Context) error) error {
+	t.active.Add(1)
+	defer t.active.Add(-1)
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(t.ctx, cancel)()
+
+	err := run(rctx)
+	if err != nil && ctx.Err() == nil && t.revoked.Load() && errors.Is(err, context.Canceled) {
+		var e *jape.Error
+		if errors.As(err, &e) {
+			return &jape.Error{Message: e.Message, Err: ErrRevoked}
+		}
+		return &jape.Error{Message: "call ended", Err: ErrRevoked}
+	}
+	return err
+}
+
+func (r *Registry) idleTimeout() time.Duration {
+	if r.IdleTimeout == 0 {
+		return DefaultTenantIdle
+	}
+	return r.IdleTimeout
+}
+
+// initLocked initializes the shared state of r, if necessary.
+func (r *Registry) initLocked() {
+	if r.base != nil {
+		return
+	}
+	base := new(jape.Client)
+	if r.Base != nil {
+		*base = *r.Base // shallow copy
+	}
+	if base.BaseURL == "" {
+		base.BaseURL = BaseURL
+	}
+	if base.HTTPClient == nil {
+		base.HTTPClient = new(http.Client) // shared by all tenants
+	}
+	r.base = base
+	r.tenants = make(map[string]*tenant)
+	r.loading = make(map[string]*tenantLoad)
+	r.appLimit = r.newLimiter("")
+	app := *base
+	app.Limiter = r.appLimit
+	r.app = (*Client)(&app)
+}
+
+func (r *Registry) newLimiter(id string) *RateLimiter {
+	lim := &RateLimiter{Policy: r.Policy}
+	if r.OnRateLimit != nil {
+		lim.OnUpdate = func(e RateLimitEvent) { r.OnRateLimit(id, e) }
+	}
+	return lim
+}
+
+// App returns the client the application uses to make requests on its own
+// behalf, using the authorizer of the base client.
+func (r *Registry) App() *Client {
+	r.μ.Lock()
+	defer r.μ.Unlock()
+	r.initLocked()
+	return r.app
+}
+
+// Client returns the client for the specified tenant, creating it if
+// necessary. The credentials of a new tenant are loaded without blocking
+// requests for other tenants; concurrent requests for the same new tenant
+// share a single call of Credentials.
+func (r *Registry) Client(id string) (*Client, error) {
+	r.μ.Lock()
+	r.initLocked()
+	now := time.Now()
+	r.sweepLocked(now)
+	if t, ok := r.tenants[id]; ok {
+		t.lastUsed.Store(now.UnixNano())
+		r.μ.Unlock()
+		return t.cli, nil
+	}
+	if r.Credentials == nil {
+		r.μ.Unlock()
+		return nil, errors.New("registry has no credentials")
+	}
+	l, loading := r.loading[id]
+	if !loading {
+		l = &tenantLoad{done: make(chan struct{})}
+		r.loading[id] = l
+	}
+	r.μ.Unlock()
+
+	if !loading {
+		r.load(id, l)
+	}
+	<-l.done
+	return l.cli, l.err
+}
+
+// A tenantLoad is the state of a call to load in progress.
+type tenantLoad struct {
+	done    chan struct{} // closed when the load is complete
+	revoked bool          // the tenant was revoked during the load (guarded by r.μ)
+	cli     *Client
+	err     error
+}
+
+// load creates a tenant for id using its credentials, adds it to r, and
+// reports the result in l. If the tenant is revoked while its credentials
+// are loading, they may be stale, so the tenant is discarded and l reports
+// ErrRevoked.
+func (r *Registry) load(id string, l *tenantLoad) {
+	var t *tenant
+	l.err = errors.New("loading credentials failed") // in case Credentials panics
+	defer func() {
+		r.μ.Lock()
+		delete(r.loading, id)
+		if l.revoked {
+			if t != nil {
+				t.revoke()
+			}
+			l.err = ErrRevoked
+		} else if t != nil {
+			if cur, ok := r.tenants[id]; ok {
+				t = cur
+			} else {
+				r.tenants[id] = t
+			}
+			l.cli, l.err = t.cli, nil
+		}
+		r.μ.Unlock()
+		close(l.done)
+	}()
+
+	auth, err := r.Credentials(id)
+	if err != nil {
+		l.err = err
+		return
+	}
+	t = r.newTenant(id, auth)
+}
+
+// newTenant returns a new tenant for id that authorizes requests with auth.
+func (r *Registry) newTenant(id string, auth jape.Authorizer) *tenant {
+	t := &tenant{limiter: r.newLimiter(id)}
+	t.ctx, t.revoke = context.WithCancel(context.Background())
+	t.lastUsed.Store(time.Now().UnixNano())
+	cli := *r.base // shallow copy
+	cli.Authorize = func(req *http.Request) error {
+		if t.revoked.Load() {
+			return ErrRevoked
+		}
+		t.lastUsed.Store(time.Now().UnixNano())
+		if auth == nil {
+			return nil
+		}
+		return auth(req)
+	}
+	if outer := cli.Scope; outer != nil {
+		cli.Scope = func(ctx context.Context, run func(context.Context) error) error {
+			return outer(ctx, func(ctx context.Context) error { return t.scope(ctx, run) })
+		}
+	} else {
+		cli.Scope = t.scope
+	}
+	cli.Limiter = t.limiter
+	cli.Cache = nil
+	cli.Coalescer = nil
+	t.cli = (*Client)(&cli)
+	return t
+}
+
+// Revoke removes the specified tenant from r, ends any requests and streams
+// of its client in progress, and causes any further request by its client to
+// fail with an error wrapping ErrRevoked. If the credentials of the tenant are
+// loading, the requests for its client fail with ErrRevoked. If the tenant is
+// requested again, a new client is created with fresh credentials. Revoke
+// reports whether the tenant was active or loading.
+func (r *Registry) Revoke(id string) bool {
+	r.μ.Lock()
+	defer r.μ.Unlock()
+	t, ok := r.tenants[id]
+	if ok {
+		t.revoked.Store(true)
+		t.revoke()
+		delete(r.tenants, id)
+	}
+	if l, loading := r.loading[id]; loading {
+		l.revoked = true
+		ok = true
+	}
+	return ok
+}
+
+// EvictIdle removes all tenants that have been idle for longer than the idle
+// timeout, and reports the number of tenants removed.
+func (r *Registry) EvictIdle() int {
+	r.μ.Lock()
+	defer r.μ.Unlock()
+	return r.evictLocked(time.Now())
+}
+
+// sweepLocked evicts idle tenants, if enough time has passed since the last
+// sweep to make it worthwhile.
+func (r *Registry) sweepLocked(now time.Time) {
+	if idle := r.idleTimeout(); idle > 0 && now.Sub(r.lastSweep) >= idle/2 {
+		r.evictLocked(now)
+	}
+}
+
+func (r *Registry) evictLocked(now time.Time) int {
+	idle := r.idleTimeout()
+	r.lastSweep = now
+	if idle < 0 {
+		return 0
+	}
+	var n int
+	for id, t := range r.tenants {
+		if t.active.Load() == 0 && now.Sub(time.Unix(0, t.lastUsed.Load())) > idle {
+			delete(r.tenants, id)
+			n++
+		}
+	}
+	return n
+}
+
+// Tenants returns the identifiers of the active tenants of r, in order.
+func (r *Registry) Tenants() []string {
+	r.μ.Lock()
+	defer r.μ.Unlock()
+	ids := make([]string, 0, len(r.tenants))
+	for id := range r.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// RateLimits returns a snapshot of the rate limits reported for requests by
+// the specified tenant, keyed by endpoint. It returns nil if the tenant is not
+// active. Use App().RateLimits() for the rate limits of the app.
+func (r *Registry) RateLimits(id string) map[string]RateLimit {
+	r.μ.Lock()
+	t, ok := r.tenants[id]
+	r.μ.Unlock()
+	if !ok {
+		return nil
+	}
+	return t.limiter.Snapshot()
+}
@@ -0,0 +1,336 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+)
+
+func TestRegistry(t *testing.T) {
+	remaining := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		auth := req.Header.Get("Authorization")
+		remaining[auth]++
+		w.Header().Set("x-rate-limit-limit", "100")
+		w.Header().Set("x-rate-limit-remaining", fmt.Sprint(100-remaining[auth]))
+		w.Header().Set("x-rate-limit-reset", "1700000000")
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer srv.Close()
+
+	creds := make(map[string]int)
+	var events []string
+	reg := &twitter.Registry{
+		Base: &jape.Client{
+			BaseURL:   srv.URL,
+			Authorize: jape.BearerTokenAuthorizer("app"),
+		},
+		Credentials: func(id string) (jape.Authorizer, error) {
+			if id == "nobody" {
+				return nil, errors.New("no such user")
+			}
+			creds[id]++
+			return jape.BearerTokenAuthorizer(fmt.Sprintf("%s-%d", id, creds[id])), nil
+		},
+		Policy:      twitter.Observe,
+		OnRateLimit: func(id string, e twitter.RateLimitEvent) { events = append(events, id) },
+		IdleTimeout: -1,
+	}
+	ctx := context.Background()
+	call := func(cli *twitter.Client) error {
+		_, err := cli.Call(ctx, &jape.Request{Method: "2/users/me"})
+		return err
+	}
+
+	alice, err := reg.Client("alice")
+	if err != nil {
+		t.Fatalf("Client(alice): %v", err)
+	}
+	bob, err := reg.Client("bob")
+	if err != nil {
+		t.Fatalf("Client(bob): %v", err)
+	}
+	if again, _ := reg.Client("alice"); again != alice {
+		t.Error("Client(alice) did not reuse the tenant client")
+	}
+	if alice.HTTPClient == nil || alice.HTTPClient != bob.HTTPClient || alice.HTTPClient != reg.App().HTTPClient {
+		t.Error("Tenant clients do not share an HTTP client")
+	}
+	if _, err := reg.Client("nobody"); err == nil {
+		t.Error("Client(nobody): got nil error")
+	}
+
+	for _, cli := range []*twitter.Client{alice, alice, bob, reg.App()} {
+		if err := call(cli); err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+	}
+	if got := fmt.Sprint(events); got != "[alice alice bob ]" {
+		t.Errorf("Rate limit events: got %s, want [alice alice bob ]", got)
+	}
+	for _, test := range []struct {
+		name string
+		got  map[string]twitter.RateLimit
+		want int
+	}{
+		{"alice", reg.RateLimits("alice"), 98},
+		{"bob", reg.RateLimits("bob"), 99},
+		{"app", reg.App().RateLimits(), 99},
+	} {
+		if rl := test.got["GET 2/users/me"]; rl.Remaining != test.want {
+			t.Errorf("Rate limit for %s: got %+v, want remaining %d", test.name, rl, test.want)
+		}
+	}
+
+	// Revoking a tenant stops its client, and fresh credentials are loaded if
+	// it is requested again.
+	if !reg.Revoke("alice") {
+		t.Error("Revoke(alice) reported inactive")
+	}
+	if err := call(alice); !errors.Is(err, twitter.ErrRevoked) {
+		t.Errorf("Call after Revoke: got %v, want %v", err, twitter.ErrRevoked)
+	}
+	alice2, err := reg.Client("alice")
+	if err != nil {
+		t.Fatalf("Client(alice) after Revoke: %v", err)
+	} else if err := call(alice2); err != nil {
+		t.Errorf("Call with new client: %v", err)
+	}
+	if creds["alice"] != 2 || remaining["Bearer alice-2"] != 1 {
+		t.Errorf("Credentials after Revoke: got %d loads, want 2", creds["alice"])
+	}
+	if got := fmt.Sprint(reg.Tenants()); got != "[alice bob]" {
+		t.Errorf("Tenants: got %s, want [alice bob]", got)
+	}
+	if reg.Revoke("nobody") {
+		t.Error("Revoke(nobody) reported active")
+	}
+}
+
+func TestRegistryIdle(t *testing.T) {
+	reg := &twitter.Registry{
+		Credentials: func(string) (jape.Authorizer, error) { return nil, nil },
+		IdleTimeout: 20 * time.Millisecond,
+	}
+	old, _ := reg.Client("old")
+	time.Sleep(30 * time.Millisecond)
+
+	// Requesting a client lazily evicts idle tenants.
+	reg.Client("new")
+	if got := fmt.Sprint(reg.Tenants()); got != "[new]" {
+		t.Errorf("Tenants: got %s, want [new]", got)
+	}
+	if cli, _ := reg.Client("old"); cli == old {
+		t.Error("Client(old) reused an evicted client")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if n := reg.EvictIdle(); n != 2 {
+		t.Errorf("EvictIdle: got %d, want 2", n)
+	}
+	if got := reg.Tenants(); len(got) != 0 {
+		t.Errorf("Tenants after EvictIdle: got %v, want none", got)
+	}
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	release := make(chan struct{})
+	var loads atomic.Int32
+	reg := &twitter.Registry{
+		Credentials: func(id string) (jape.Authorizer, error) {
+			if id == "slow" {
+				loads.Add(1)
+				<-release
+			}
+			return nil, nil
+		},
+	}
+
+	// Start several requests for a tenant whose credentials are slow to load.
+	clients := make([]*twitter.Client, 3)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cli, err := reg.Client("slow")
+			if err != nil {
+				t.Errorf("Client(slow): %v", err)
+			}
+			clients[i] = cli
+		}(i)
+	}
+	for loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Other tenants are not blocked while the credentials load.
+	if _, err := reg.Client("fast"); err != nil {
+		t.Errorf("Client(fast): %v", err)
+	}
+	if got := fmt.Sprint(reg.Tenants()); got != "[fast]" {
+		t.Errorf("Tenants while loading: got %s, want [fast]", got)
+	}
+
+	close(release)
+	wg.Wait()
+	if n := loads.Load(); n != 1 {
+		t.Errorf("Credentials(slow): got %d loads, want 1", n)
+	}
+	for _, cli := range clients[1:] {
+		if cli != clients[0] {
+			t.Error("Concurrent requests got different clients")
+		}
+	}
+	if got := fmt.Sprint(reg.Tenants()); got != "[fast slow]" {
+		t.Errorf("Tenants: got %s, want [fast slow]", got)
+	}
+}
+
+func TestRegistryRevokeStream(t *testing.T) {
+	var calls atomic.Int32
+	var events []jape.StreamEventType
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		for i := 1; ; i++ {
+			fmt.Fprintf(w, "{\"n\":%d}\r\n", i)
+			w.(http.Flusher).Flush()
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}))
+	defer srv.Close()
+
+	reg := &twitter.Registry{
+		Base: &jape.Client{
+			HTTPClient: srv.Client(),
+			BaseURL:    srv.URL,
+			Reconnect: &jape.ReconnectPolicy{
+				NetworkDelay: time.Millisecond,
+				OnEvent:      func(e jape.StreamEvent) { events = append(events, e.Type) },
+			},
+		},
+		Credentials: func(string) (jape.Authorizer, error) { return nil, nil },
+		IdleTimeout: 10 * time.Millisecond,
+	}
+	cli, err := reg.Client("alice")
+	if err != nil {
+		t.Fatalf("Client(alice): %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var nmsg int
+	err = cli.Stream(ctx, &jape.Request{Method: "2/tweets/sample/stream"}, func(*twitter.Reply) error {
+		if nmsg++; nmsg == 2 {
+			// A tenant with a stream in progress is not idle, however long ago
+			// the stream began.
+			time.Sleep(20 * time.Millisecond)
+			if n := reg.EvictIdle(); n != 0 {
+				t.Errorf("EvictIdle while streaming: got %d, want 0", n)
+			}
+			if !reg.Revoke("alice") {
+				t.Error("Revoke(alice) reported no active tenant")
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, twitter.ErrRevoked) {
+		t.Errorf("Stream after Revoke: got %v, want %v", err, twitter.ErrRevoked)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Stream: got %d requests, want 1", n)
+	}
+	if got := fmt.Sprint(events); got != "[Connected]" {
+		t.Errorf("Stream events: got %s, want [Connected]", got)
+	}
+}
+
+func TestRegistryRevokeLoading(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	reg := &twitter.Registry{
+		Credentials: func(string) (jape.Authorizer, error) {
+			close(started)
+			<-release
+			return nil, nil
+		},
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := reg.Client("alice")
+		done <- err
+	}()
+	<-started
+
+	// Credentials loaded before the revocation may be stale, so they are not
+	// used.
+	if !reg.Revoke("alice") {
+		t.Error("Revoke(alice) while loading: got false, want true")
+	}
+	close(release)
+	if err := <-done; !errors.Is(err, twitter.ErrRevoked) {
+		t.Errorf("Client(alice): got %v, want %v", err, twitter.ErrRevoked)
+	}
+	if got := reg.Tenants(); len(got) != 0 {
+		t.Errorf("Tenants: got %v, want none", got)
+	}
+}
+
+func TestRegistryRevokeWaiting(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("x-rate-limit-limit", "1")
+		w.Header().Set("x-rate-limit-remaining", "0")
+		w.Header().Set("x-rate-limit-reset", strconv.FormatInt(reset, 10))
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	defer srv.Close()
+
+	reg := &twitter.Registry{
+		Base:        &jape.Client{HTTPClient: srv.Client(), BaseURL: srv.URL},
+		Credentials: func(string) (jape.Authorizer, error) { return nil, nil },
+		Policy:      twitter.WaitForReset,
+	}
+	cli, err := reg.Client("alice")
+	if err != nil {
+		t.Fatalf("Client(alice): %v", err)
+	}
+	ctx := context.Background()
+	if _, err := cli.Call(ctx, &jape.Request{Method: "2/users/me"}); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+
+	// The budget is spent, so the next call waits for the reset until the
+	// tenant is revoked.
+	done := make(chan error, 1)
+	go func() {
+		_, err := cli.Call(ctx, &jape.Request{Method: "2/users/me"})
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	reg.Revoke("alice")
+	select {
+	case err := <-done:
+		if !errors.Is(err, twitter.ErrRevoked) {
+			t.Errorf("Call after Revoke: got %v, want %v", err, twitter.ErrRevoked)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Call did not end after Revoke")
+	}
+}
@@ -6,18 +6,14 @@ import (
 	"context"
 	"encoding/json"
 	"flag"
-	"io"
 	"log"
 	"net/http"
 	"os"
-	"strings"
 	"testing"
 
-	"github.com/dnaeon/go-vcr/v2/cassette"
-	"github.com/dnaeon/go-vcr/v2/recorder"
-
 	"github.com/creachadair/twitter"
 	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/jape/replay"
 	"github.com/creachadair/twitter/lists"
 	"github.com/creachadair/twitter/query"
 	"github.com/creachadair/twitter/rules"
@@ -27,44 +23,19 @@ import (
 )
 
 var (
-	testDataFile = flag.String("testdata", "testdata/test-record", "Path of test data file")
+	testDataFile = flag.String("testdata", "testdata/test-record.yaml", "Path of test data file")
 	testMode     = flag.String("mode", "replay", "Test mode (record, replay, run)")
 	doVerboseLog = flag.Bool("verbose-log", false, "Enable verbose client logging")
 	maxBodyBytes = flag.Int64("max-body-size", 12000,
-		"Maximum response body size when recording (0=unlimited)")
+		"Maximum stream response body size when recording")
 
 	cli *twitter.Client // see TestMain
 )
 
-// limitTransport wraps an http.RoundTripper to artificially truncate the
-// response body to a fixed limit. We need to do this when recording stream
-// methods, because the recorder consumes the whole response body before it
-// returns any data to the client.
-type limitTransport struct {
-	real  http.RoundTripper
-	limit int64
-}
-
-func (t limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	rsp, err := t.real.RoundTrip(req)
-	if err == nil {
-		rsp.Body = readCloser{
-			Reader: io.LimitReader(rsp.Body, t.limit),
-			Closer: rsp.Body,
-		}
-	}
-	return rsp, err
-}
-
-type readCloser struct {
-	io.Reader
-	io.Closer
-}
-
 const fakeAuthToken = "this-is-a-fake-auth-token-for-testing"
 
-// This test uses the go-vcr module to replay recorded HTTP interactions,
-// captured from the live Twitter API.
+// This test uses the jape/replay package to replay recorded HTTP
+// interactions, captured from the live Twitter API.
 //
 // For ordinary use, run "go test", which will use the test-record.yaml file
 // checked in under the testdata directory. This is equivalent to -mode=replay.
@@ -75,30 +46,24 @@ const fakeAuthToken = "this-is-a-fake-auth-token-for-testing"
 //
 // To record a new testdata file, run "go test -mode=record". Don't forget to
 // check in any changes you obtain in this way. This mode also requires a real
-// bearer token in the TWITTER_TOKEN environment.
+// bearer token in the TWITTER_TOKEN environment. The recorder scrubs the
+// token from the recording.
 //
 // Use the -testdata flag to specify the location of the test data file.
 //
 // Use -verbose-log to get spammy client debug logging. This is mainly useful
 // when you are verifying that the recording worked.
-//
-// Known deficiencies:
-//
-//   - Each interaction is marked as "played" once it has been used so that it
-//     cannot be replayed. This is sensible, but means if you run go test with
-//     -count > 1 or multiple -cpu options, it will fail on all runs after the
-//     first because it can't find the interactions again.
 func TestMain(m *testing.M) {
 	flag.Parse()
 
-	var mode recorder.Mode
+	var mode replay.Mode
 	switch *testMode {
 	case "replay":
-		mode = recorder.ModeReplaying
+		mode = replay.Replay
 	case "record":
-		mode = recorder.ModeRecording
+		mode = replay.Record
 	case "run":
-		mode = recorder.ModeDisabled
+		mode = replay.Passthrough
 	default:
 		log.Fatalf("Unknown recorder mode %q (options: record, replay, run)", *testMode)
 	}
@@ -108,21 +73,19 @@ func TestMain(m *testing.M) {
 		log.Fatal("You must provide a non-empty -testdata file path")
 	}
 
-	// When recording, we need to limit the size of response bodies from the
-	// server so that streaming methods do not stall the recorder.
+	// When recording, we need to limit the size of stream response bodies from
+	// the server so that streaming methods do not stall the recorder.
 	//
 	// You want as small a limit as possible so as not to blow up the test data
 	// size, but if it's too small the client will fail spuriously. The
 	// practical solution is empiricism: Run production queries with a trial
 	// limit and adjust the limit till they all pass.
-
-	var rt http.RoundTripper = http.DefaultTransport
-	if *testMode == "record" && *maxBodyBytes > 0 {
-		rt = limitTransport{real: rt, limit: *maxBodyBytes}
-		log.Printf("Limiting response bodies to %d bytes", *maxBodyBytes)
+	opts := &replay.Options{MaxStreamBytes: *maxBodyBytes}
+	if *testMode == "record" {
+		log.Printf("Limiting stream response bodies to %d bytes", *maxBodyBytes)
 	}
 
-	rec, err := recorder.NewAsMode(*testDataFile, mode, rt)
+	rec, err := replay.Open(*testDataFile, mode, opts)
 	if err != nil {
 		log.Fatalf("Opening recorder %q: %v", *testDataFile, err)
 	}
@@ -142,23 +105,6 @@ func TestMain(m *testing.M) {
 		auth = jape.BearerTokenAuthorizer(fakeAuthToken)
 	}
 
-	// Filter Authorization headers when recording to swap the real token with
-	// the fake, so we don't check in production credentials with testdata.
-	if *testMode == "record" {
-		rec.AddFilter(func(in *cassette.Interaction) error {
-			// This relies on the fact that Values promises not to return a copy.
-			auth := in.Request.Headers.Values("Authorization")
-			for i, v := range auth {
-				if strings.HasPrefix(v, "Bearer ") {
-					auth[i] = "Bearer " + fakeAuthToken
-					return nil
-				}
-			}
-			log.Printf("WARNING: No Authorization found in request")
-			return nil
-		})
-	}
-
 	cli = twitter.NewClient(&jape.Client{
 		HTTPClient: &http.Client{Transport: rec},
 		Authorize:  auth,
@@ -170,13 +116,11 @@ func TestMain(m *testing.M) {
 		}
 	}
 	os.Exit(func() int {
-		if rec != nil {
-			defer func() {
-				if err := rec.Stop(); err != nil {
-					log.Fatalf("Stopping recorder: %v", err)
-				}
-			}()
-		}
+		defer func() {
+			if err := rec.Close(); err != nil {
+				log.Fatalf("Stopping recorder: %v", err)
+			}
+		}()
 		log.Printf("Running tests (mode=%s)...", *testMode)
 		return m.Run() // run the actual tests
 	}())
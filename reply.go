@@ -8,7 +8,6 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/creachadair/twitter/jape"
 	"github.com/creachadair/twitter/types"
 )
 
@@ -35,79 +34,29 @@ type Reply struct {
 
 // IncludedMedia decodes any media objects in the includes of r.
 // It returns nil without error if there are no media inclusions.
-func (r *Reply) IncludedMedia() (types.Medias, error) {
-	media, ok := r.Includes["media"]
-	if !ok || len(media) == 0 {
-		return nil, nil
-	}
-	var out types.Medias
-	if err := json.Unmarshal(media, &out); err != nil {
-		return nil, &jape.Error{Data: media, Message: "decoding media", Err: err}
-	}
-	return out, nil
-}
+func (r *Reply) IncludedMedia() (types.Medias, error) { return Included[types.Media](r) }
 
 // IncludedTweets decodes any tweet objects in the includes of r.
 // It returns nil without error if there are no tweet inclusions.
-func (r *Reply) IncludedTweets() (types.Tweets, error) {
-	tweets, ok := r.Includes["tweets"]
-	if !ok || len(tweets) == 0 {
-		return nil, nil
-	}
-	var out types.Tweets
-	if err := json.Unmarshal(tweets, &out); err != nil {
-		return nil, &jape.Error{Data: tweets, Message: "decoding tweets", Err: err}
-	}
-	return out, nil
-}
+func (r *Reply) IncludedTweets() (types.Tweets, error) { return Included[types.Tweet](r) }
 
 // IncludedUsers decodes any user objects in the includes of r.
 // It returns nil without error if there are no user inclusions.
-func (r *Reply) IncludedUsers() (types.Users, error) {
-	users, ok := r.Includes["users"]
-	if !ok || len(users) == 0 {
-		return nil, nil
-	}
-	var out types.Users
-	if err := json.Unmarshal(users, &out); err != nil {
-		return nil, &jape.Error{Data: users, Message: "decoding users", Err: err}
-	}
-	return out, nil
-}
+func (r *Reply) IncludedUsers() (types.Users, error) { return Included[types.User](r) }
 
 // IncludedPolls decodes any poll objects in the includes of r.
 // It returns nil without error if there are no poll inclusions.
-func (r *Reply) IncludedPolls() (types.Polls, error) {
-	polls, ok := r.Includes["polls"]
-	if !ok || len(polls) == 0 {
-		return nil, nil
-	}
-	var out types.Polls
-	if err := json.Unmarshal(polls, &out); err != nil {
-		return nil, &jape.Error{Data: polls, Message: "decoding polls", Err: err}
-	}
-	return out, nil
-}
+func (r *Reply) IncludedPolls() (types.Polls, error) { return Included[types.Poll](r) }
 
 // IncludedPlaces decodes any place objects in the includes of r.
 // It returns nil without error if there are no place inclusions.
-func (r *Reply) IncludedPlaces() (types.Places, error) {
-	places, ok := r.Includes["places"]
-	if !ok || len(places) == 0 {
-		return nil, nil
-	}
-	var out types.Places
-	if err := json.Unmarshal(places, &out); err != nil {
-		return nil, &jape.Error{Data: places, Message: "decoding places", Err: err}
-	}
-	return out, nil
-}
+func (r *Reply) IncludedPlaces() (types.Places, error) { return Included[types.Place](r) }
 
 // RateLimit records metadata about API rate limits reported by the server.
 type RateLimit struct {
-	Ceiling   int       // rate limit ceiling for this endpoint
-	Remaining int       // requests remaining in the current window
-	Reset     time.Time // time of next window reset
+	Ceiling   int       `json:"ceiling"`   // rate limit ceiling for this endpoint
+	Remaining int       `json:"remaining"` // requests remaining in the current window
+	Reset     time.Time `json:"reset"`     // time of next window reset
 }
 
 func decodeRateLimits(h http.Header) *RateLimit {
@@ -135,3 +84,12 @@ type Pagination struct {
 	ResultCount int    `json:"result_count"`
 	NextToken   string `json:"next_token"`
 }
+
+// Next returns the token for the next page of results, or "" if there are no
+// more pages. Next is safe to call on a nil *Pagination.
+func (p *Pagination) Next() string {
+	if p == nil {
+		return ""
+	}
+	return p.NextToken
+}
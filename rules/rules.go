@@ -100,12 +100,12 @@ type Query struct {
 }
 
 // Invoke executes the query on the given context and client.
-func (q Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
+func (q Query) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (*Reply, error) {
 	// Report a deferred error from encoding.
 	if q.encodeErr != nil {
 		return nil, &jape.Error{Message: "encoding rule set", Err: q.encodeErr}
 	}
-	rsp, err := cli.Call(ctx, q.request)
+	rsp, err := cli.Call(ctx, q.request, opts...)
 	if err != nil {
 		return nil, err
 	}
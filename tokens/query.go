@@ -17,10 +17,10 @@ import (
 	"github.com/creachadair/twitter/jape/auth"
 )
 
-func clientWithAuth(cli *twitter.Client, auth jape.Authorizer) *twitter.Client {
-	cp := *cli // shallow copy
-	cp.Authorize = auth
-	return &cp
+// withAuth returns opts preceded by an option to authorize the request with
+// auth, so that the caller's options take precedence.
+func withAuth(auth jape.Authorizer, opts []twitter.CallOption) []twitter.CallOption {
+	return append([]twitter.CallOption{twitter.WithAuthorizer(auth)}, opts...)
 }
 
 // UsePIN is used as the callback in an authorization ticket request to request
@@ -52,8 +52,8 @@ type RequestQuery struct {
 }
 
 // Invoke issues the query to the given client and returns the request Token.
-func (q RequestQuery) Invoke(ctx context.Context, cli *twitter.Client) (Token, error) {
-	data, err := clientWithAuth(cli, q.authorize).CallRaw(ctx, q.Request)
+func (q RequestQuery) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (Token, error) {
+	data, err := cli.CallRaw(ctx, q.Request, withAuth(q.authorize, opts)...)
 	if err != nil {
 		return Token{}, err
 	}
@@ -103,8 +103,8 @@ type AccessQuery struct {
 }
 
 // Invoke issues the query and returns the access Token.
-func (a AccessQuery) Invoke(ctx context.Context, cli *twitter.Client) (AccessToken, error) {
-	data, err := cli.CallRaw(ctx, a.Request)
+func (a AccessQuery) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (AccessToken, error) {
+	data, err := cli.CallRaw(ctx, a.Request, opts...)
 	if err != nil {
 		return AccessToken{}, err
 	}
@@ -171,11 +171,11 @@ type BearerQuery struct {
 type BearerOpts struct{}
 
 // Invoke issues the query and returns the bearer token.
-func (q BearerQuery) Invoke(ctx context.Context, cli *twitter.Client) (Token, error) {
-	data, err := clientWithAuth(cli, func(hreq *http.Request) error {
+func (q BearerQuery) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (Token, error) {
+	data, err := cli.CallRaw(ctx, q.Request, withAuth(func(hreq *http.Request) error {
 		hreq.SetBasicAuth(url.QueryEscape(q.user), url.QueryEscape(q.password))
 		return nil
-	}).CallRaw(ctx, q.Request)
+	}, opts)...)
 	if err != nil {
 		return Token{}, err
 	}
@@ -238,8 +238,8 @@ type InvalidateQuery struct {
 }
 
 // Invoke issues the query and returns the invalidated token.
-func (q InvalidateQuery) Invoke(ctx context.Context, cli *twitter.Client) (string, error) {
-	data, err := clientWithAuth(cli, q.authorize).CallRaw(ctx, q.Request)
+func (q InvalidateQuery) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (string, error) {
+	data, err := cli.CallRaw(ctx, q.Request, withAuth(q.authorize, opts)...)
 	if err != nil {
 		return "", err
 	}
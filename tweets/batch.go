@@ -0,0 +1,77 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package tweets
+
+import (
+	"context"
+	"sort"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/types"
+)
+
+// LookupAll constructs a lookup query for any number of tweet IDs. The IDs
+// are looked up in batches of at most twitter.MaxLookupIDs, and the replies
+// are merged into one. The optional fields of opts apply to each batch; any
+// IDs in opts.More are looked up after those in ids.
+//
+// API: 2/tweets
+func LookupAll(ids []string, opts *LookupOpts) BatchQuery {
+	q := BatchQuery{ids: ids}
+	if opts != nil {
+		q.ids = append(ids[:len(ids):len(ids)], opts.More...)
+		q.optional = opts.Optional
+	}
+	return q
+}
+
+// A BatchQuery performs a lookup query for any number of tweet IDs.
+type BatchQuery struct {
+	// The maximum number of batches to look up concurrently.
+	// If zero, use twitter.DefaultBatchConcurrency.
+	Concurrency int
+
+	ids      []string
+	optional []types.Fields
+}
+
+// Invoke executes the query on the given context and client. The options
+// apply to the request for each batch. If any batch fails, Invoke reports an
+// error and no results. With twitter.WithRequireAll, the merged reply is
+// checked once all the batches are complete.
+//
+// The tweets of the reply are in the order of the requested IDs. Tweets that
+// could not be found are reported in the Errors of the reply, in the order of
+// their batches. The reply has no metadata.
+func (q BatchQuery) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (*Reply, error) {
+	rsps, err := twitter.Batches(ctx, q.ids, twitter.MaxLookupIDs, q.Concurrency,
+		func(ctx context.Context, ids []string) (*Reply, error) {
+			return Lookup(ids[0], &LookupOpts{More: ids[1:], Optional: q.optional}).Invoke(ctx, cli, opts...)
+		})
+	if err != nil {
+		return nil, err
+	}
+	out := new(Reply)
+	base := make([]*twitter.Reply, len(rsps))
+	for i, rsp := range rsps {
+		base[i] = rsp.Reply
+		out.Tweets = append(out.Tweets, rsp.Tweets...)
+	}
+	out.Reply, err = twitter.MergeReplies(base)
+	if err != nil {
+		return nil, err
+	} else if twitter.RequiresAll(opts) {
+		if err := twitter.CheckMissing(out.Reply, "ids", q.ids); err != nil {
+			return nil, err
+		}
+	}
+
+	pos := make(map[string]int, len(q.ids))
+	for i := len(q.ids) - 1; i >= 0; i-- {
+		pos[q.ids[i]] = i
+	}
+	sort.SliceStable(out.Tweets, func(i, j int) bool {
+		return pos[out.Tweets[i].ID] < pos[out.Tweets[j].ID]
+	})
+	return out, nil
+}
@@ -76,7 +76,7 @@ func (o *StreamOpts) maxResults() int {
 type Callback func(*Reply) error
 
 // Invoke executes the streaming query on the given context and client.
-func (s Stream) Invoke(ctx context.Context, cli *twitter.Client) error {
+func (s Stream) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) error {
 	var nr int
 	return cli.Stream(ctx, s.Request, func(rsp *twitter.Reply) error {
 		nr++
@@ -93,5 +93,5 @@ func (s Stream) Invoke(ctx context.Context, cli *twitter.Client) error {
 			return jape.ErrStopStreaming
 		}
 		return nil
-	})
+	}, opts...)
 }
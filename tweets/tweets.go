@@ -56,6 +56,10 @@
 //
 // Use q.ResetPageToken to reset the query.
 //
+// Alternatively, q.Pager returns a twitter.Pager that fetches the pages
+// without modifying q, with an optional cap on the number of results and a
+// cursor that can be saved to resume paging later.
+//
 // # Streaming
 //
 // Streaming queries take a callback that receives each response sent by the
@@ -86,6 +90,18 @@
 //	      types.MediaFields{PublicMetrics: true},
 //	   },
 //	}
+//
+// By default a stream ends when the connection to the server is lost. To
+// reconnect automatically, set a reconnect policy on the client:
+//
+//	cli.Reconnect = &jape.ReconnectPolicy{
+//	   OnEvent: func(e jape.StreamEvent) {
+//	      log.Printf("Stream %s: %v", e.Type, e.Err)
+//	   },
+//	}
+//
+// With a reconnect policy, the MaxResults option counts results delivered
+// across all connections.
 package tweets
 
 import (
@@ -117,8 +133,9 @@ func Lookup(id string, opts *LookupOpts) Query {
 // API: 2/users/:id/liked_tweets
 func LikedBy(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/liked_tweets",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/liked_tweets",
+		Template: "2/users/:id/liked_tweets",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -129,8 +146,9 @@ func LikedBy(userID string, opts *ListOpts) Query {
 // API: 2/tweets/:id/quote_tweets
 func Quotes(id string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/tweets/" + id + "/quote_tweets",
-		Params: make(jape.Params),
+		Method:   "2/tweets/" + id + "/quote_tweets",
+		Template: "2/tweets/:id/quote_tweets",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -141,8 +159,9 @@ func Quotes(id string, opts *ListOpts) Query {
 // API: 2/users/:id/mentions
 func MentioningUser(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/mentions",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/mentions",
+		Template: "2/users/:id/mentions",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -153,8 +172,9 @@ func MentioningUser(userID string, opts *ListOpts) Query {
 // API: 2/users/:id/tweets
 func FromUser(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/tweets",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/tweets",
+		Template: "2/users/:id/tweets",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -165,8 +185,9 @@ func FromUser(userID string, opts *ListOpts) Query {
 // API: 2/users/:id/bookmarks
 func BookmarkedBy(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/bookmarks",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/bookmarks",
+		Template: "2/users/:id/bookmarks",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -190,11 +211,11 @@ func (q Query) nextTokenParam() string {
 // Invoke executes the query on the given context and client. If the reply
 // contains a pagination token, q is updated in-place so that invoking the
 // query again will fetch the next page.
-func (q Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
+func (q Query) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (*Reply, error) {
 	if q.encodeErr != nil {
 		return nil, q.encodeErr // deferred encoding error
 	}
-	rsp, err := cli.Call(ctx, q.Request)
+	rsp, err := cli.Call(ctx, q.Request, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -243,6 +264,19 @@ func (q Query) HasMorePages() bool {
 // invoking the query will then fetch the first page of results.
 func (q Query) ResetPageToken() { q.Request.Params.Reset(q.nextTokenParam()) }
 
+// Pager returns a pager over the tweets reported by q. The pager does not
+// modify q.
+func (q Query) Pager(opts *twitter.PageOpts) *twitter.Pager[*types.Tweet] {
+	params := twitter.PageParams{Token: q.nextTokenParam(), Size: "max_results"}
+	return twitter.NewPager(q.Request, params, func(ctx context.Context, cli *twitter.Client, req *jape.Request, copts ...twitter.CallOption) (*twitter.Page[*types.Tweet], error) {
+		rsp, err := Query{Request: req, encodeErr: q.encodeErr}.Invoke(ctx, cli, copts...)
+		if err != nil {
+			return nil, err
+		}
+		return &twitter.Page[*types.Tweet]{Items: rsp.Tweets, Next: rsp.Meta.Next(), Reply: rsp.Reply}, nil
+	}, opts)
+}
+
 // A Reply is the response from a Query.
 type Reply struct {
 	*twitter.Reply
@@ -250,6 +284,12 @@ type Reply struct {
 	Meta   *twitter.Pagination
 }
 
+// Hydrate resolves the expansions of the tweets in r using the includes of r.
+// See twitter.HydrateTweets.
+func (r *Reply) Hydrate() (*twitter.Hydrated[*twitter.TweetNode], error) {
+	return twitter.HydrateTweets(r.Reply, r.Tweets)
+}
+
 // LookupOpts provides parameters for tweet lookup. A nil *LookupOpts provides
 // empty values for all fields.
 type LookupOpts struct {
@@ -39,6 +39,7 @@ package twitter
 import (
 	"context"
 	"encoding/json"
+	"errors"
 
 	"github.com/creachadair/twitter/jape"
 )
@@ -55,7 +56,9 @@ const (
 
 // NewClient returns a new client for the Twitter API.
 // If cli == nil, default client options are used targeting the production API
-// at BaseURL.
+// at BaseURL. If cli has no Limiter, NewClient sets a RateLimiter with the
+// Observe policy, so that the RateLimits method of the client reports the rate
+// limits of its requests without enforcing them.
 func NewClient(cli *jape.Client) *Client {
 	if cli == nil {
 		cli = new(jape.Client)
@@ -63,6 +66,9 @@ func NewClient(cli *jape.Client) *Client {
 	if cli.BaseURL == "" {
 		cli.BaseURL = BaseURL
 	}
+	if cli.Limiter == nil {
+		cli.Limiter = &RateLimiter{Policy: Observe}
+	}
 	return (*Client)(cli)
 }
 
@@ -75,30 +81,40 @@ type Client jape.Client
 type Callback func(*Reply) error
 
 // Call issues the specified API request and returns the decoded reply.
+// The top-level fields of the response are decoded as it is read, but the
+// Data field is kept as raw JSON, so most of a large reply is still buffered.
 // Errors from Call have concrete type *jape.Error.
-func (c *Client) Call(ctx context.Context, req *jape.Request) (*Reply, error) {
-	header, body, err := (*jape.Client)(c).Call(ctx, req)
+func (c *Client) Call(ctx context.Context, req *jape.Request, opts ...CallOption) (*Reply, error) {
+	ctx, c, req, cancel := c.withOptions(ctx, req, opts)
+	defer cancel()
+	var reply Reply
+	header, err := (*jape.Client)(c).CallJSON(ctx, req, &reply)
 	if err != nil {
 		return nil, err
 	}
-	var reply Reply
-	if err := json.Unmarshal(body, &reply); err != nil {
-		return nil, &jape.Error{Data: body, Message: "decoding response body", Err: err}
-	}
 	reply.RateLimit = decodeRateLimits(header)
+	if len(opts) != 0 && newCallOptions(opts).all && !inBatch(ctx) {
+		if err := checkMissing(req, &reply); err != nil {
+			return nil, err
+		}
+	}
 	return &reply, nil
 }
 
 // CallRaw issues the specified API request and returns the raw response body
 // without decoding. Errors from CallRaw have concrete type *jape.Error
-func (c *Client) CallRaw(ctx context.Context, req *jape.Request) ([]byte, error) {
+func (c *Client) CallRaw(ctx context.Context, req *jape.Request, opts ...CallOption) ([]byte, error) {
+	ctx, c, req, cancel := c.withOptions(ctx, req, opts)
+	defer cancel()
 	_, body, err := (*jape.Client)(c).Call(ctx, req)
 	return body, err
 }
 
 // Stream issues the specified API request and streams results to the given
 // callback. Errors from Stream have concrete type *jape.Error.
-func (c *Client) Stream(ctx context.Context, req *jape.Request, f Callback) error {
+func (c *Client) Stream(ctx context.Context, req *jape.Request, f Callback, opts ...CallOption) error {
+	ctx, c, req, cancel := c.withOptions(ctx, req, opts)
+	defer cancel()
 	return (*jape.Client)(c).Stream(ctx, req, func(body []byte) error {
 		var reply Reply
 		if err := json.Unmarshal(body, &reply); err != nil {
@@ -107,3 +123,37 @@ func (c *Client) Stream(ctx context.Context, req *jape.Request, f Callback) erro
 		return f(&reply)
 	})
 }
+
+// Explain reports the first request that invoke would send to the API using
+// cli, without sending it. Typically invoke is the Invoke method of a query,
+// for example:
+//
+//	ex, err := twitter.Explain(ctx, cli, lists.Delete(listID).Invoke)
+//	if err != nil {
+//	   log.Fatalf("Explain failed: %v", err)
+//	}
+//	fmt.Print(ex.Describe())
+//
+// The request is constructed and authorized as it would be by cli with the
+// given call options, but with secrets redacted (unless cli.LogSecrets is
+// set). See jape.Explanation.
+func Explain[T any](ctx context.Context, cli *Client, invoke func(context.Context, *Client, ...CallOption) (T, error), opts ...CallOption) (*jape.Explanation, error) {
+	return ExplainFunc(ctx, cli, func(ctx context.Context, dry *Client, opts ...CallOption) error {
+		_, err := invoke(ctx, dry, opts...)
+		return err
+	}, opts...)
+}
+
+// ExplainFunc is as Explain, for a query whose Invoke method reports only an
+// error, such as a stream.
+func ExplainFunc(ctx context.Context, cli *Client, invoke func(context.Context, *Client, ...CallOption) error, opts ...CallOption) (*jape.Explanation, error) {
+	dry := *cli // shallow copy
+	dry.DryRun = true
+	err := invoke(ctx, &dry, opts...)
+	if ex := jape.Explain(err); ex != nil {
+		return ex, nil
+	} else if err == nil {
+		return nil, errors.New("query did not issue a request")
+	}
+	return nil, err
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2020 Michael J. Fromberger. All Rights Reserved.
+
+package users
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/types"
+)
+
+// LookupAll constructs a lookup query for any number of users by ID. The IDs
+// are looked up in batches of at most twitter.MaxLookupIDs, and the replies
+// are merged into one. The optional fields of opts apply to each batch; any
+// IDs in opts.More are looked up after those in ids.
+//
+// API: 2/users
+func LookupAll(ids []string, opts *LookupOpts) BatchQuery {
+	return newBatch(Lookup, "ids", ids, opts, func(u *types.User) string { return u.ID })
+}
+
+// LookupAllByName constructs a lookup query for any number of users by
+// username, as LookupAll does for IDs.
+//
+// API: 2/users/by
+func LookupAllByName(names []string, opts *LookupOpts) BatchQuery {
+	q := newBatch(LookupByName, "usernames", names, opts, func(u *types.User) string {
+		return strings.ToLower(u.Username)
+	})
+	for i, name := range q.keys {
+		q.keys[i] = strings.ToLower(name) // usernames are not case-sensitive
+	}
+	return q
+}
+
+func newBatch(lookup func(string, *LookupOpts) Query, param string, keys []string, opts *LookupOpts, key func(*types.User) string) BatchQuery {
+	q := BatchQuery{lookup: lookup, param: param, keys: append([]string(nil), keys...), key: key}
+	if opts != nil {
+		q.keys = append(q.keys, opts.More...)
+		q.optional = opts.Optional
+	}
+	return q
+}
+
+// A BatchQuery performs a lookup query for any number of users.
+type BatchQuery struct {
+	// The maximum number of batches to look up concurrently.
+	// If zero, use twitter.DefaultBatchConcurrency.
+	Concurrency int
+
+	lookup   func(string, *LookupOpts) Query
+	param    string // the request parameter for keys
+	keys     []string
+	key      func(*types.User) string
+	optional []types.Fields
+}
+
+// Invoke executes the query on the given context and client. The options
+// apply to the request for each batch. If any batch fails, Invoke reports an
+// error and no results. With twitter.WithRequireAll, the merged reply is
+// checked once all the batches are complete.
+//
+// The users of the reply are in the order of the requested IDs or usernames.
+// Users that could not be found are reported in the Errors of the reply, in
+// the order of their batches. The reply has no metadata.
+func (q BatchQuery) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (*Reply, error) {
+	rsps, err := twitter.Batches(ctx, q.keys, twitter.MaxLookupIDs, q.Concurrency,
+		func(ctx context.Context, keys []string) (*Reply, error) {
+			return q.lookup(keys[0], &LookupOpts{More: keys[1:], Optional: q.optional}).Invoke(ctx, cli, opts...)
+		})
+	if err != nil {
+		return nil, err
+	}
+	out := new(Reply)
+	base := make([]*twitter.Reply, len(rsps))
+	for i, rsp := range rsps {
+		base[i] = rsp.Reply
+		out.Users = append(out.Users, rsp.Users...)
+	}
+	out.Reply, err = twitter.MergeReplies(base)
+	if err != nil {
+		return nil, err
+	} else if twitter.RequiresAll(opts) {
+		if err := twitter.CheckMissing(out.Reply, q.param, q.keys); err != nil {
+			return nil, err
+		}
+	}
+
+	pos := make(map[string]int, len(q.keys))
+	for i := len(q.keys) - 1; i >= 0; i-- {
+		pos[q.keys[i]] = i
+	}
+	sort.SliceStable(out.Users, func(i, j int) bool {
+		return pos[q.key(out.Users[i])] < pos[q.key(out.Users[j])]
+	})
+	return out, nil
+}
@@ -21,6 +21,14 @@
 //
 // To look up users by username, use users.LookupByName. As above, additional
 // usernames can be included in the option keys.
+//
+// A single lookup accepts at most twitter.MaxLookupIDs keys. To look up any
+// number of users, use users.LookupAll or users.LookupAllByName, which split
+// the keys into batches and merge the replies:
+//
+//	q := users.LookupAll(ids, nil)
+//	q.Concurrency = 8 // batches in flight at once
+//	rsp, err := q.Invoke(ctx, cli)
 package users
 
 import (
@@ -64,8 +72,9 @@ func newLookup(method, param, key string, opts *LookupOpts) Query {
 // API: 2/users/:id/followers
 func FollowersOf(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/followers",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/followers",
+		Template: "2/users/:id/followers",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -76,8 +85,9 @@ func FollowersOf(userID string, opts *ListOpts) Query {
 // API: 2/users/:id/following
 func FollowedBy(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/following",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/following",
+		Template: "2/users/:id/following",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -88,8 +98,9 @@ func FollowedBy(userID string, opts *ListOpts) Query {
 // API: 2/users/:id/muting
 func MutedBy(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/muting",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/muting",
+		Template: "2/users/:id/muting",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -100,8 +111,9 @@ func MutedBy(userID string, opts *ListOpts) Query {
 // API: 2/users/:id/blocking
 func BlockedBy(userID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/users/" + userID + "/blocking",
-		Params: make(jape.Params),
+		Method:   "2/users/" + userID + "/blocking",
+		Template: "2/users/:id/blocking",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -112,8 +124,9 @@ func BlockedBy(userID string, opts *ListOpts) Query {
 // API: 2/tweets/:id/retweeted_by
 func RetweetersOf(tweetID string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/tweets/" + tweetID + "/retweeted_by",
-		Params: make(jape.Params),
+		Method:   "2/tweets/" + tweetID + "/retweeted_by",
+		Template: "2/tweets/:id/retweeted_by",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -129,8 +142,9 @@ func RetweetersOf(tweetID string, opts *ListOpts) Query {
 // will report an error.
 func LikersOf(id string, opts *ListOpts) Query {
 	req := &jape.Request{
-		Method: "2/tweets/" + id + "/liking_users",
-		Params: make(jape.Params),
+		Method:   "2/tweets/" + id + "/liking_users",
+		Template: "2/tweets/:id/liking_users",
+		Params:   make(jape.Params),
 	}
 	opts.addRequestParams(req)
 	return Query{Request: req}
@@ -142,8 +156,8 @@ type Query struct {
 }
 
 // Invoke executes the query on the given context and client.
-func (q Query) Invoke(ctx context.Context, cli *twitter.Client) (*Reply, error) {
-	rsp, err := cli.Call(ctx, q.Request)
+func (q Query) Invoke(ctx context.Context, cli *twitter.Client, opts ...twitter.CallOption) (*Reply, error) {
+	rsp, err := cli.Call(ctx, q.Request, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -179,6 +193,19 @@ func (q Query) HasMorePages() bool {
 // invoking the query will then fetch the first page of results.
 func (q Query) ResetPageToken() { q.Request.Params.Reset(twitter.NextTokenParam) }
 
+// Pager returns a pager over the users reported by q. The pager does not
+// modify q.
+func (q Query) Pager(opts *twitter.PageOpts) *twitter.Pager[*types.User] {
+	params := twitter.PageParams{Token: twitter.NextTokenParam, Size: "max_results"}
+	return twitter.NewPager(q.Request, params, func(ctx context.Context, cli *twitter.Client, req *jape.Request, copts ...twitter.CallOption) (*twitter.Page[*types.User], error) {
+		rsp, err := Query{Request: req}.Invoke(ctx, cli, copts...)
+		if err != nil {
+			return nil, err
+		}
+		return &twitter.Page[*types.User]{Items: rsp.Users, Next: rsp.Meta.Next(), Reply: rsp.Reply}, nil
+	}, opts)
+}
+
 // A Reply is the response from a Query.
 type Reply struct {
 	*twitter.Reply
@@ -186,6 +213,12 @@ type Reply struct {
 	Meta  *twitter.Pagination
 }
 
+// Hydrate resolves the expansions of the users in r using the includes of r.
+// See twitter.HydrateUsers.
+func (r *Reply) Hydrate() (*twitter.Hydrated[*twitter.UserNode], error) {
+	return twitter.HydrateUsers(r.Reply, r.Users)
+}
+
 // LookupOpts provide parameters for user lookup. A nil *LookupOpts provides
 // empty values for all fields.
 type LookupOpts struct {